@@ -0,0 +1,108 @@
+package flags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/freakmaxi/locking-center/cli/errors"
+	"github.com/freakmaxi/locking-center/cli/terminal"
+)
+
+const barriersRemoteCommand = "BARS"
+
+type barriersCommand struct {
+	managerAddress *net.TCPAddr
+	output         terminal.Output
+	basePath       string
+	args           []string
+}
+
+func NewBarriers(managerAddress *net.TCPAddr, output terminal.Output, basePath string, args []string) execution {
+	return &barriersCommand{
+		managerAddress: managerAddress,
+		output:         output,
+		basePath:       basePath,
+		args:           args,
+	}
+}
+
+func (b *barriersCommand) Parse() error {
+	for len(b.args) > 0 {
+		arg := b.args[0]
+		switch arg {
+		case "-h":
+			return errors.ErrShowUsage
+		default:
+			if strings.Index(arg, "-") == 0 {
+				return fmt.Errorf("unsupported argument for barriers command")
+			}
+		}
+		break
+	}
+
+	if len(b.args) > 0 {
+		return fmt.Errorf("barriers command does not take arguments")
+	}
+
+	return nil
+}
+
+func (b *barriersCommand) PrintUsage() {
+	b.output.Println("  barriers    List waiting barriers.")
+	b.output.Println("              Shows the arrived and the expected party counts of the barriers.")
+	b.output.Println("")
+	b.output.Println("arguments:")
+	b.output.Println("  -h          shows this help text")
+	b.output.Println("")
+	b.output.Refresh()
+}
+
+func (b *barriersCommand) Name() string {
+	return "barriers"
+}
+
+func (b *barriersCommand) Execute() error {
+	conn, err := net.DialTCP("tcp", nil, b.managerAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(barriersRemoteCommand)); err != nil {
+		return err
+	}
+
+	var barriersCount uint32
+	if err := binary.Read(conn, binary.LittleEndian, &barriersCount); err != nil {
+		return err
+	}
+
+	for ; barriersCount > 0; barriersCount-- {
+		var keySize uint8
+		if err := binary.Read(conn, binary.LittleEndian, &keySize); err != nil {
+			return err
+		}
+
+		keyBytes := make([]byte, keySize)
+		if _, err := io.ReadAtLeast(conn, keyBytes, len(keyBytes)); err != nil {
+			return err
+		}
+
+		var parties uint16
+		if err := binary.Read(conn, binary.LittleEndian, &parties); err != nil {
+			return err
+		}
+
+		var arrived uint16
+		if err := binary.Read(conn, binary.LittleEndian, &arrived); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s (%d/%d arrived)\n", string(keyBytes), arrived, parties)
+	}
+
+	return nil
+}
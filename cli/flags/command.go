@@ -50,8 +50,12 @@ func (c *Command) printUsage() {
 	fmt.Println("  --version           Prints release version")
 	fmt.Println()
 	fmt.Println("commands:")
-	fmt.Println("  keys    List locking keys.")
-	fmt.Println("  reset   Reset locking key and release all locks.")
+	fmt.Println("  keys      List locking keys.")
+	fmt.Println("  reset     Reset locking key and release all locks.")
+	fmt.Println("  graph     List wait-for graph of the clients.")
+	fmt.Println("  stats     Show statistics of the service.")
+	fmt.Println("  barriers  List waiting barriers.")
+	fmt.Println("  latches   List countdown latches.")
 	fmt.Println()
 }
 
@@ -85,7 +89,7 @@ func (c *Command) Parse() bool {
 		}
 
 		switch arg {
-		case "keys", "reset":
+		case "keys", "reset", "graph", "stats", "barriers", "latches":
 			mrArgs := make([]string, 0)
 			if i+1 < len(c.args) {
 				mrArgs = c.args[i+1:]
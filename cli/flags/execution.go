@@ -26,6 +26,14 @@ func newExecution(managerAddress string, output terminal.Output, command string,
 		return NewKeys(addr, output, basePath, args), nil
 	case "reset":
 		return NewReset(addr, output, basePath, args), nil
+	case "graph":
+		return NewGraph(addr, output, basePath, args), nil
+	case "stats":
+		return NewStats(addr, output, basePath, args), nil
+	case "barriers":
+		return NewBarriers(addr, output, basePath, args), nil
+	case "latches":
+		return NewLatches(addr, output, basePath, args), nil
 	}
 
 	return nil, fmt.Errorf("unsupported command")
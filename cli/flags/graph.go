@@ -0,0 +1,117 @@
+package flags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/freakmaxi/locking-center/cli/errors"
+	"github.com/freakmaxi/locking-center/cli/terminal"
+)
+
+const graphRemoteCommand = "GRPH"
+
+type graphCommand struct {
+	managerAddress *net.TCPAddr
+	output         terminal.Output
+	basePath       string
+	args           []string
+}
+
+func NewGraph(managerAddress *net.TCPAddr, output terminal.Output, basePath string, args []string) execution {
+	return &graphCommand{
+		managerAddress: managerAddress,
+		output:         output,
+		basePath:       basePath,
+		args:           args,
+	}
+}
+
+func (g *graphCommand) Parse() error {
+	for len(g.args) > 0 {
+		arg := g.args[0]
+		switch arg {
+		case "-h":
+			return errors.ErrShowUsage
+		default:
+			if strings.Index(arg, "-") == 0 {
+				return fmt.Errorf("unsupported argument for graph command")
+			}
+		}
+		break
+	}
+
+	if len(g.args) > 0 {
+		return fmt.Errorf("graph command does not take arguments")
+	}
+
+	return nil
+}
+
+func (g *graphCommand) PrintUsage() {
+	g.output.Println("  graph       List wait-for graph of the clients.")
+	g.output.Println("              Only the lock requests that have client identity take place in the graph.")
+	g.output.Println("")
+	g.output.Println("arguments:")
+	g.output.Println("  -h          shows this help text")
+	g.output.Println("")
+	g.output.Refresh()
+}
+
+func (g *graphCommand) Name() string {
+	return "graph"
+}
+
+func (g *graphCommand) Execute() error {
+	conn, err := net.DialTCP("tcp", nil, g.managerAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(graphRemoteCommand)); err != nil {
+		return err
+	}
+
+	var edgesCount uint32
+	if err := binary.Read(conn, binary.LittleEndian, &edgesCount); err != nil {
+		return err
+	}
+
+	for ; edgesCount > 0; edgesCount-- {
+		key, err := g.readString(conn)
+		if err != nil {
+			return err
+		}
+
+		waiter, err := g.readString(conn)
+		if err != nil {
+			return err
+		}
+
+		holder, err := g.readString(conn)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s -> %s (%s)\n", waiter, holder, key)
+	}
+
+	return nil
+}
+
+func (g *graphCommand) readString(conn *net.TCPConn) (string, error) {
+	var valueSize uint8
+	if err := binary.Read(conn, binary.LittleEndian, &valueSize); err != nil {
+		return "", err
+	}
+
+	valueBytes := make([]byte, valueSize)
+	if _, err := io.ReadAtLeast(conn, valueBytes, len(valueBytes)); err != nil {
+		return "", err
+	}
+
+	return string(valueBytes), nil
+}
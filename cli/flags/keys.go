@@ -97,50 +97,210 @@ func (k *keysCommand) Execute() error {
 			return err
 		}
 
-		var sourceAddrSize uint8
-		if err := binary.Read(conn, binary.LittleEndian, &sourceAddrSize); err != nil {
+		var mode uint8
+		if err := binary.Read(conn, binary.LittleEndian, &mode); err != nil {
 			return err
 		}
 
-		sourceAddrBytes := make([]byte, sourceAddrSize)
-		if _, err := io.ReadAtLeast(conn, sourceAddrBytes, len(sourceAddrBytes)); err != nil {
+		var permits uint16
+		if err := binary.Read(conn, binary.LittleEndian, &permits); err != nil {
 			return err
 		}
 
-		var endPointSize uint8
-		if err := binary.Read(conn, binary.LittleEndian, &endPointSize); err != nil {
+		var fence uint64
+		if err := binary.Read(conn, binary.LittleEndian, &fence); err != nil {
 			return err
 		}
 
-		endPointBytes := make([]byte, endPointSize)
-		if _, err := io.ReadAtLeast(conn, endPointBytes, len(endPointBytes)); err != nil {
+		var holdersCount uint32
+		if err := binary.Read(conn, binary.LittleEndian, &holdersCount); err != nil {
 			return err
 		}
 
-		var unixTime int64
-		if err := binary.Read(conn, binary.LittleEndian, &unixTime); err != nil {
+		if !k.detailed && mode != 2 && mode != 3 { // Intent only ancestors are not locked themselves
+			fmt.Println(string(keyBytes))
+		}
+
+		modeName := "exclusive"
+		switch mode {
+		case 1:
+			modeName = "shared"
+		case 2:
+			modeName = "intent shared"
+		case 3:
+			modeName = "intent exclusive"
+		}
+		if permits > 0 {
+			modeName = fmt.Sprintf("semaphore %d/%d free", int(permits)-int(holdersCount), permits)
+		}
+
+		for ; holdersCount > 0; holdersCount-- {
+			if err := k.holder(conn, string(keyBytes), modeName, fence); err != nil {
+				return err
+			}
+		}
+
+		var queueCount uint32
+		if err := binary.Read(conn, binary.LittleEndian, &queueCount); err != nil {
 			return err
 		}
 
-		if k.detailed {
-			t := time.Unix(unixTime, 0)
-			r := strings.Split(string(endPointBytes), ":")
-			d := time.Now().Sub(t)
+		for position := uint32(1); position <= queueCount; position++ {
+			if err := k.waiter(conn, string(keyBytes), position); err != nil {
+				return err
+			}
+		}
+	}
 
-			fmt.Printf(
-				"%15s:%-5s -> %s (%9.3fs) %s (%s)\n",
-				r[0],
-				r[1],
-				t.Local().Format("2006 Jan 02 15:04:03"),
-				d.Seconds(),
-				string(keyBytes),
-				string(sourceAddrBytes),
-			)
+	return nil
+}
 
-			continue
+func (k *keysCommand) waiter(conn *net.TCPConn, key string, position uint32) error {
+	var priority uint8
+	if err := binary.Read(conn, binary.LittleEndian, &priority); err != nil {
+		return err
+	}
+
+	var ticket uint64
+	if err := binary.Read(conn, binary.LittleEndian, &ticket); err != nil {
+		return err
+	}
+
+	var sourceAddrSize uint8
+	if err := binary.Read(conn, binary.LittleEndian, &sourceAddrSize); err != nil {
+		return err
+	}
+
+	sourceAddrBytes := make([]byte, sourceAddrSize)
+	if _, err := io.ReadAtLeast(conn, sourceAddrBytes, len(sourceAddrBytes)); err != nil {
+		return err
+	}
+
+	var endPointSize uint8
+	if err := binary.Read(conn, binary.LittleEndian, &endPointSize); err != nil {
+		return err
+	}
+
+	endPointBytes := make([]byte, endPointSize)
+	if _, err := io.ReadAtLeast(conn, endPointBytes, len(endPointBytes)); err != nil {
+		return err
+	}
+
+	var waited int64
+	if err := binary.Read(conn, binary.LittleEndian, &waited); err != nil {
+		return err
+	}
+
+	if !k.detailed {
+		return nil
+	}
+
+	r := strings.Split(string(endPointBytes), ":")
+
+	fmt.Printf(
+		"%15s:%-5s    %4d. in queue (%9.3fs) %s (%s) (ticket %d, priority %d)\n",
+		r[0],
+		r[1],
+		position,
+		(time.Duration(waited) * time.Millisecond).Seconds(),
+		key,
+		string(sourceAddrBytes),
+		ticket,
+		priority,
+	)
+
+	return nil
+}
+
+func (k *keysCommand) holder(conn *net.TCPConn, key string, modeName string, fence uint64) error {
+	var sourceAddrSize uint8
+	if err := binary.Read(conn, binary.LittleEndian, &sourceAddrSize); err != nil {
+		return err
+	}
+
+	sourceAddrBytes := make([]byte, sourceAddrSize)
+	if _, err := io.ReadAtLeast(conn, sourceAddrBytes, len(sourceAddrBytes)); err != nil {
+		return err
+	}
+
+	var endPointSize uint8
+	if err := binary.Read(conn, binary.LittleEndian, &endPointSize); err != nil {
+		return err
+	}
+
+	endPointBytes := make([]byte, endPointSize)
+	if _, err := io.ReadAtLeast(conn, endPointBytes, len(endPointBytes)); err != nil {
+		return err
+	}
+
+	var unixTime int64
+	if err := binary.Read(conn, binary.LittleEndian, &unixTime); err != nil {
+		return err
+	}
+
+	var leaseLeft int64
+	if err := binary.Read(conn, binary.LittleEndian, &leaseLeft); err != nil {
+		return err
+	}
+
+	var metadataCount uint8
+	if err := binary.Read(conn, binary.LittleEndian, &metadataCount); err != nil {
+		return err
+	}
+
+	metadata := make([]string, 0, metadataCount)
+	for ; metadataCount > 0; metadataCount-- {
+		var metadataKeySize uint8
+		if err := binary.Read(conn, binary.LittleEndian, &metadataKeySize); err != nil {
+			return err
+		}
+
+		metadataKeyBytes := make([]byte, metadataKeySize)
+		if _, err := io.ReadAtLeast(conn, metadataKeyBytes, len(metadataKeyBytes)); err != nil {
+			return err
+		}
+
+		var metadataValueSize uint8
+		if err := binary.Read(conn, binary.LittleEndian, &metadataValueSize); err != nil {
+			return err
+		}
+
+		metadataValueBytes := make([]byte, metadataValueSize)
+		if _, err := io.ReadAtLeast(conn, metadataValueBytes, len(metadataValueBytes)); err != nil {
+			return err
 		}
 
-		fmt.Println(string(keyBytes))
+		metadata = append(metadata, fmt.Sprintf("%s=%s", metadataKeyBytes, metadataValueBytes))
+	}
+
+	if !k.detailed {
+		return nil
+	}
+
+	t := time.Unix(unixTime, 0)
+	r := strings.Split(string(endPointBytes), ":")
+	d := time.Now().Sub(t)
+
+	lease := "no lease"
+	if leaseLeft > 0 {
+		lease = fmt.Sprintf("%.3fs left", (time.Duration(leaseLeft) * time.Millisecond).Seconds())
+	}
+
+	fmt.Printf(
+		"%15s:%-5s -> %s (%9.3fs) %s (%s) [%s] %s #%d\n",
+		r[0],
+		r[1],
+		t.Local().Format("2006 Jan 02 15:04:03"),
+		d.Seconds(),
+		key,
+		string(sourceAddrBytes),
+		lease,
+		modeName,
+		fence,
+	)
+
+	for _, entry := range metadata {
+		fmt.Printf("%21s    %s\n", "", entry)
 	}
 
 	return nil
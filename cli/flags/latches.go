@@ -0,0 +1,118 @@
+package flags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/freakmaxi/locking-center/cli/errors"
+	"github.com/freakmaxi/locking-center/cli/terminal"
+)
+
+const latchesRemoteCommand = "LTCH"
+
+type latchesCommand struct {
+	managerAddress *net.TCPAddr
+	output         terminal.Output
+	basePath       string
+	args           []string
+}
+
+func NewLatches(managerAddress *net.TCPAddr, output terminal.Output, basePath string, args []string) execution {
+	return &latchesCommand{
+		managerAddress: managerAddress,
+		output:         output,
+		basePath:       basePath,
+		args:           args,
+	}
+}
+
+func (l *latchesCommand) Parse() error {
+	for len(l.args) > 0 {
+		arg := l.args[0]
+		switch arg {
+		case "-h":
+			return errors.ErrShowUsage
+		default:
+			if strings.Index(arg, "-") == 0 {
+				return fmt.Errorf("unsupported argument for latches command")
+			}
+		}
+		break
+	}
+
+	if len(l.args) > 0 {
+		return fmt.Errorf("latches command does not take arguments")
+	}
+
+	return nil
+}
+
+func (l *latchesCommand) PrintUsage() {
+	l.output.Println("  latches     List countdown latches.")
+	l.output.Println("              Shows the remaining counts and the waiters of the latches.")
+	l.output.Println("")
+	l.output.Println("arguments:")
+	l.output.Println("  -h          shows this help text")
+	l.output.Println("")
+	l.output.Refresh()
+}
+
+func (l *latchesCommand) Name() string {
+	return "latches"
+}
+
+func (l *latchesCommand) Execute() error {
+	conn, err := net.DialTCP("tcp", nil, l.managerAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(latchesRemoteCommand)); err != nil {
+		return err
+	}
+
+	var latchesCount uint32
+	if err := binary.Read(conn, binary.LittleEndian, &latchesCount); err != nil {
+		return err
+	}
+
+	for ; latchesCount > 0; latchesCount-- {
+		var keySize uint8
+		if err := binary.Read(conn, binary.LittleEndian, &keySize); err != nil {
+			return err
+		}
+
+		keyBytes := make([]byte, keySize)
+		if _, err := io.ReadAtLeast(conn, keyBytes, len(keyBytes)); err != nil {
+			return err
+		}
+
+		var count uint32
+		if err := binary.Read(conn, binary.LittleEndian, &count); err != nil {
+			return err
+		}
+
+		var remaining uint32
+		if err := binary.Read(conn, binary.LittleEndian, &remaining); err != nil {
+			return err
+		}
+
+		var waiting uint32
+		if err := binary.Read(conn, binary.LittleEndian, &waiting); err != nil {
+			return err
+		}
+
+		state := "open"
+		if remaining > 0 {
+			state = fmt.Sprintf("%d/%d remaining", remaining, count)
+		}
+
+		fmt.Printf("%s (%s, %d waiting)\n", string(keyBytes), state, waiting)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package flags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/freakmaxi/locking-center/cli/errors"
+	"github.com/freakmaxi/locking-center/cli/terminal"
+)
+
+const statsRemoteCommand = "STAT"
+
+type statsCommand struct {
+	managerAddress *net.TCPAddr
+	output         terminal.Output
+	basePath       string
+	args           []string
+}
+
+func NewStats(managerAddress *net.TCPAddr, output terminal.Output, basePath string, args []string) execution {
+	return &statsCommand{
+		managerAddress: managerAddress,
+		output:         output,
+		basePath:       basePath,
+		args:           args,
+	}
+}
+
+func (s *statsCommand) Parse() error {
+	for len(s.args) > 0 {
+		arg := s.args[0]
+		switch arg {
+		case "-h":
+			return errors.ErrShowUsage
+		default:
+			if strings.Index(arg, "-") == 0 {
+				return fmt.Errorf("unsupported argument for stats command")
+			}
+		}
+		break
+	}
+
+	if len(s.args) > 0 {
+		return fmt.Errorf("stats command does not take arguments")
+	}
+
+	return nil
+}
+
+func (s *statsCommand) PrintUsage() {
+	s.output.Println("  stats       Show statistics of the service.")
+	s.output.Println("              Live channels are the keys that are held, waited for or in use at the moment.")
+	s.output.Println("")
+	s.output.Println("arguments:")
+	s.output.Println("  -h          shows this help text")
+	s.output.Println("")
+	s.output.Refresh()
+}
+
+func (s *statsCommand) Name() string {
+	return "stats"
+}
+
+func (s *statsCommand) Execute() error {
+	conn, err := net.DialTCP("tcp", nil, s.managerAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(statsRemoteCommand)); err != nil {
+		return err
+	}
+
+	var channelsCount uint32
+	if err := binary.Read(conn, binary.LittleEndian, &channelsCount); err != nil {
+		return err
+	}
+
+	fmt.Printf("live channels: %d\n", channelsCount)
+
+	return nil
+}
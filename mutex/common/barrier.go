@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// Barrier blocks the arriving requests on the key until the number of parties arrive and releases them together
+type Barrier struct {
+	Key string
+
+	mutex    sync.Mutex
+	parties  uint16 // Number of the requests that trips the barrier, set by the first arrival
+	arrivals []*Request
+	users    int // Number of the calls that use the barrier at the moment, guarded by the mutex of the lock
+}
+
+func NewBarrier(key string) *Barrier {
+	return &Barrier{
+		Key:      key,
+		mutex:    sync.Mutex{},
+		arrivals: make([]*Request, 0),
+	}
+}
+
+// Arrive waits until the number of parties arrive at the barrier or the context is done. When the context is
+// done, the request leaves the barrier and does not count as arrived anymore
+func (b *Barrier) Arrive(ctx context.Context, r *Request, parties uint16) error {
+	b.mutex.Lock()
+
+	if len(b.arrivals) == 0 {
+		b.parties = parties
+	}
+	if b.parties != parties {
+		b.mutex.Unlock()
+		return ErrParties
+	}
+
+	r.ready = make(chan error, 1)
+	b.arrivals = append(b.arrivals, r)
+
+	if len(b.arrivals) == int(b.parties) {
+		for _, arrival := range b.arrivals {
+			arrival.ready <- nil
+		}
+		b.arrivals = make([]*Request, 0)
+	}
+	b.mutex.Unlock()
+
+	select {
+	case err := <-r.ready:
+		return err
+	case <-ctx.Done():
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if !b.leave(r) { // Barrier is tripped at the same time
+			return <-r.ready
+		}
+		return ctx.Err()
+	}
+}
+
+func (b *Barrier) leave(r *Request) bool {
+	for i := range b.arrivals {
+		if b.arrivals[i] != r {
+			continue
+		}
+		b.arrivals = append(b.arrivals[:i], b.arrivals[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// idle checks if there is no request waiting at the barrier
+func (b *Barrier) idle() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.arrivals) == 0
+}
+
+func (b *Barrier) Report() *BarrierReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.arrivals) == 0 {
+		return nil
+	}
+
+	return &BarrierReport{
+		Key:     b.Key,
+		Parties: b.parties,
+		Arrived: uint16(len(b.arrivals)),
+	}
+}
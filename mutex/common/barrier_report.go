@@ -0,0 +1,15 @@
+package common
+
+import "strings"
+
+type BarrierReport struct {
+	Key     string
+	Parties uint16
+	Arrived uint16
+}
+
+type BarrierReports []*BarrierReport
+
+func (b BarrierReports) Len() int           { return len(b) }
+func (b BarrierReports) Less(i, j int) bool { return strings.Compare(b[i].Key, b[j].Key) < 0 }
+func (b BarrierReports) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
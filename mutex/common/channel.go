@@ -1,104 +1,727 @@
 package common
 
 import (
+	"context"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Channel struct {
 	Key    string
 	Latest *Request
 
-	mutexChan chan bool
+	mutex    sync.Mutex
+	holders  map[string]*Request
+	queue    []*Request // Waiting requests in the granting order, higher priority first and then the oldest ticket
+	queueMap map[string]*Request
+	waiters  []*Request // Released holders that wait for a signal on the key to take it back
+	closed   bool
+	permits  uint16 // Number of holders that the key allows at once as a semaphore, 0 makes it a lock
+	users    int    // Number of the calls that use the channel at the moment, guarded by the mutex of the lock
 
-	queueLock sync.Mutex
-	queueMap  map[string]*Request
+	sequence uint64 // Ticket of the latest waiting request
+	fence    uint64
+
+	onWait    func(c *Channel, r *Request)               // Called when the request waits or others take its key
+	onQueue   func(key string, r *Request, waiting bool) // Called when the request enters or leaves the queue
+	onRelease func(r *Request)                           // Called in the background when a holder with intents leaves
+	onIdle    func(c *Channel)                           // Called in the background when the last lease expires
+	onEvent   func(t EventType, key string, r *Request)  // Called when the key is acquired or released, can not block
 }
 
 func NewChannel(key string) *Channel {
 	return &Channel{
-		Key:       key,
-		mutexChan: make(chan bool, 1),
-		queueLock: sync.Mutex{},
-		queueMap:  make(map[string]*Request),
+		Key:      key,
+		mutex:    sync.Mutex{},
+		holders:  make(map[string]*Request),
+		queue:    make([]*Request, 0),
+		queueMap: make(map[string]*Request),
+		waiters:  make([]*Request, 0),
 	}
 }
 
 func (c *Channel) pushToQueue(r *Request) {
-	c.queueLock.Lock()
-	defer c.queueLock.Unlock()
+	c.sequence++
+	r.Sequence = c.sequence
+	r.queued = time.Now().UTC()
+
+	index := sort.Search(len(c.queue), func(i int) bool { return c.queue[i].Priority < r.Priority })
+
+	c.queue = append(c.queue, nil)
+	copy(c.queue[index+1:], c.queue[index:])
+	c.queue[index] = r
 
 	c.queueMap[r.Id] = r
+
+	if c.onQueue != nil {
+		c.onQueue(c.Key, r, true)
+	}
 }
 
 func (c *Channel) pullFromQueue(requestId string) *Request {
-	c.queueLock.Lock()
-	defer c.queueLock.Unlock()
-
 	request, has := c.queueMap[requestId]
 	if !has {
 		return nil
 	}
 	delete(c.queueMap, requestId)
 
+	for i := range c.queue {
+		if c.queue[i] != request {
+			continue
+		}
+		c.queue = append(c.queue[:i], c.queue[i+1:]...)
+		break
+	}
+
+	if c.onQueue != nil {
+		c.onQueue(c.Key, request, false)
+	}
+
 	return request
 }
 
-func (c *Channel) Push(r *Request) {
-	defer func() { _ = recover() }() // Handle close channel exception
+// Push waits in the queue until the key is granted to the request or the context is done. When the
+// context is done, the request is removed from the queue and the context error is returned
+func (c *Channel) Push(ctx context.Context, r *Request) error {
+	c.mutex.Lock()
+
+	if c.closed {
+		c.mutex.Unlock()
+		return ErrReset
+	}
+
+	if reentered, err := c.reenter(r); reentered || err != nil {
+		c.mutex.Unlock()
+		return err
+	}
 
+	if err := c.adopt(r); err != nil {
+		c.mutex.Unlock()
+		return err
+	}
+
+	if c.admissible(r) {
+		c.grant(r)
+		c.mutex.Unlock()
+		return nil
+	}
+
+	r.ready = make(chan error, 1)
 	c.pushToQueue(r)
-	c.mutexChan <- true
-	c.Latest = c.pullFromQueue(r.Id)
+	c.dispatch() // Prior request may be compatible with the holders while the ones behind it are not
+	_, queued := c.queueMap[r.Id]
+	c.mutex.Unlock()
 
-	if c.Latest == nil {
-		c.Pull()
+	if queued && c.onWait != nil {
+		c.onWait(c, r)
+	}
+
+	select {
+	case err := <-r.ready:
+		return err
+	case <-ctx.Done():
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.pullFromQueue(r.Id) == nil { // Request is answered at the same time
+			return <-r.ready
+		}
+		c.dispatch() // Leaving request may let the ones behind it in
+
+		return ctx.Err()
+	}
+}
+
+// TryPush grants the key to the request only if it is free at the moment, without queueing the request. If the key
+// is not free, ErrBusy is returned
+func (c *Channel) TryPush(r *Request) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrReset
 	}
+
+	if reentered, err := c.reenter(r); reentered || err != nil {
+		return err
+	}
+
+	if err := c.adopt(r); err != nil {
+		return err
+	}
+
+	if !c.admissible(r) {
+		return ErrBusy
+	}
+	c.grant(r)
+
+	return nil
 }
 
-func (c *Channel) Pull() {
+// reenter increases the hold count of the reentrant holder that has the same client identity with the reentrant
+// request instead of queueing the request behind its own holder. Reentered request shares the owner and fencing
+// tokens of the holder
+func (c *Channel) reenter(r *Request) (bool, error) {
+	if !r.Reentrant || len(r.ClientId) == 0 {
+		return false, nil
+	}
+
+	for _, holder := range c.holders {
+		if !holder.Reentrant || strings.Compare(holder.ClientId, r.ClientId) != 0 {
+			continue
+		}
+
+		if holder.Mode.isIntent() && r.Mode.isIntent() { // Intents of the sibling keys hold the ancestor side by side
+			continue
+		}
+
+		if !holder.Mode.covers(r.Mode) {
+			return false, ErrUpgrade
+		}
+
+		holder.holds++
+		r.reentered = true
+		r.Id = holder.Id
+		r.Fence = holder.Fence
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// adopt takes the permit count of the request when the channel is idle, otherwise the request should
+// have the same permit count with the channel
+func (c *Channel) adopt(r *Request) error {
+	if len(c.holders) == 0 && len(c.queueMap) == 0 {
+		c.permits = r.Permits
+		return nil
+	}
+	if c.permits != r.Permits {
+		return ErrPermits
+	}
+	return nil
+}
+
+// admissible checks if the request can take the key without waiting in the queue. Requests do not pass the
+// waiting ones, so the key is granted in the arrival order
+func (c *Channel) admissible(r *Request) bool {
+	if c.sibling(r) { // Waiting ones may wait for the sibling, so the intent does not wait behind them
+		return c.grantable(r)
+	}
+	return len(c.queue) == 0 && c.grantable(r)
+}
+
+// sibling checks if the intent request is taken for a sibling key of an intent that is already held on the key by the
+// same request or the same reentrant client
+func (c *Channel) sibling(r *Request) bool {
+	if !r.Mode.isIntent() {
+		return false
+	}
+
+	for _, holder := range c.holders {
+		if !holder.Mode.isIntent() {
+			continue
+		}
+		if strings.Compare(holder.parent, r.parent) == 0 {
+			return true
+		}
+		if r.Reentrant && holder.Reentrant && len(r.ClientId) > 0 && strings.Compare(holder.ClientId, r.ClientId) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// grantable checks if the request is compatible with the holders of the key
+func (c *Channel) grantable(r *Request) bool {
+	if c.permits > 0 {
+		return len(c.holders) < int(c.permits)
+	}
+
+	for _, holder := range c.holders {
+		if !holder.Mode.compatible(r.Mode) {
+			return false
+		}
+	}
+	return true
+}
+
+// dispatch grants the key to the waiting requests from the head of the queue as long as they are compatible
+// with the holders. A shared request waiting behind an exclusive one does not pass it, so neither side starves
+func (c *Channel) dispatch() {
+	granted := false
+	for len(c.queue) > 0 {
+		request := c.queue[0]
+		if !c.grantable(request) {
+			break
+		}
+		c.answer(request, nil)
+		granted = true
+	}
+
+	if !granted || len(c.queue) == 0 || c.onWait == nil {
+		return
+	}
+
+	// The requests that are still waiting wait for the new holders now, that may close a cycle
+	waiting := make([]*Request, 0, len(c.queue))
+	for _, request := range c.queue {
+		if len(request.ClientId) == 0 {
+			continue
+		}
+		waiting = append(waiting, request)
+	}
+	if len(waiting) == 0 {
+		return
+	}
+	go c.recheck(waiting)
+}
+
+// recheck runs the wait hook again for the requests that keep waiting after the holders of the key change
+func (c *Channel) recheck(waiting []*Request) {
+	for _, request := range waiting {
+		c.onWait(c, request)
+	}
+}
+
+// answer removes the request from the queue and wakes it up. If there is no error, the key is granted
+func (c *Channel) answer(r *Request, err error) {
+	c.pullFromQueue(r.Id)
+	if err == nil {
+		c.grant(r)
+	}
+	r.ready <- err
+}
+
+func (c *Channel) grant(r *Request) {
+	c.fence++
+	r.Fence = c.fence
+
+	r.holds = 1
+	c.holders[r.Id] = r
+	c.Latest = r
+
+	c.notify(EventAcquired, r)
+
+	if r.Lease == 0 {
+		return
+	}
+
+	c.lease(r, r.Lease)
+}
+
+func (c *Channel) lease(r *Request, duration time.Duration) {
+	if r.leaseTimer != nil {
+		r.leaseTimer.Stop()
+	}
+
+	r.leaseId++
+	leaseId := r.leaseId
+
+	r.expires = time.Now().UTC().Add(duration)
+	r.leaseTimer = time.AfterFunc(duration, func() { c.expire(r, leaseId) })
+}
+
+// expire releases the key when the lease of the holder runs out so the next waiter can take it
+func (c *Channel) expire(r *Request, leaseId uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.holders[r.Id] != r || r.leaseId != leaseId { // Lease is already released or renewed
+		return
+	}
+	c.release(r, EventExpired)
+	c.dispatch()
+
+	if len(c.holders) == 0 && len(c.queueMap) == 0 && c.onIdle != nil {
+		go c.onIdle(c)
+	}
+}
+
+// Renew extends the lease of the holder without releasing the key. If lease is 0, the holder's
+// own lease duration is used again
+func (c *Channel) Renew(requestId string, lease time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	holder, has := c.holders[requestId]
+	if !has {
+		return ErrNotHolder
+	}
+
+	if lease == 0 {
+		lease = holder.Lease
+	}
+	if lease == 0 {
+		return nil
+	}
+	holder.Lease = lease
+	c.lease(holder, lease)
+
+	return nil
+}
+
+func (c *Channel) Pull(requestId string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	holder, has := c.holders[requestId]
+	if !has {
+		return ErrNotHolder
+	}
+
+	if holder.holds > 1 { // Reentered holder keeps the key until all its locks are unlocked
+		holder.holds--
+		return nil
+	}
+	c.release(holder, EventReleased)
+	c.dispatch()
+
+	return nil
+}
+
+func (c *Channel) release(r *Request, eventType EventType) {
+	c.notify(eventType, r)
+
+	if r.leaseTimer != nil {
+		r.leaseTimer.Stop()
+		r.leaseTimer = nil
+	}
+	r.expires = time.Time{}
+
+	delete(c.holders, r.Id)
+
+	if len(r.intents) > 0 && c.onRelease != nil {
+		go c.onRelease(r)
+	}
+
+	if c.Latest != r {
+		return
+	}
 	c.Latest = nil
-	if len(c.mutexChan) > 0 { // Avoid deadlock on empty channel
-		<-c.mutexChan
+	for _, holder := range c.holders {
+		if c.Latest == nil || holder.Fence > c.Latest.Fence {
+			c.Latest = holder
+		}
+	}
+}
+
+// Wait releases the key of the holder and waits for a signal on the key. Signaled holder waits in the queue again
+// and takes the key back with the same owner token and a new fencing token. When the context is done, the request
+// leaves the key without holding it
+func (c *Channel) Wait(ctx context.Context, requestId string) (*Request, error) {
+	c.mutex.Lock()
+
+	holder, has := c.holders[requestId]
+	if !has {
+		c.mutex.Unlock()
+		return nil, ErrNotHolder
+	}
+
+	if holder.holds > 1 {
+		c.mutex.Unlock()
+		return nil, ErrReentered
+	}
+
+	intents := holder.intents
+	holder.intents = nil // Holder keeps its intents while waiting for the signal
+	c.release(holder, EventReleased)
+	holder.intents = intents
+
+	holder.ready = make(chan error, 1)
+	c.waiters = append(c.waiters, holder)
+	c.dispatch()
+
+	c.mutex.Unlock()
+
+	select {
+	case err := <-holder.ready:
+		return holder, err
+	case <-ctx.Done():
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if c.leave(holder) {
+			return holder, ctx.Err()
+		}
+
+		if c.pullFromQueue(holder.Id) == nil { // Request is answered at the same time
+			return holder, <-holder.ready
+		}
+		c.dispatch()
+
+		return holder, ctx.Err()
+	}
+}
+
+func (c *Channel) leave(r *Request) bool {
+	for i := range c.waiters {
+		if c.waiters[i] != r {
+			continue
+		}
+		c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// Signal moves the oldest waiter, or all of them if it is a broadcast, to the queue of the key and returns the
+// number of the signaled waiters
+func (c *Channel) Signal(broadcast bool) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	count := len(c.waiters)
+	if !broadcast && count > 1 {
+		count = 1
+	}
+
+	for _, waiter := range c.waiters[:count] {
+		c.pushToQueue(waiter)
+	}
+	c.waiters = append(c.waiters[:0], c.waiters[count:]...)
+	c.dispatch()
+
+	return count
+}
+
+// notify tells the event of the request to the watchers. Intents are left out, because they are the side effect of
+// the locks on the descendant keys
+func (c *Channel) notify(eventType EventType, r *Request) {
+	if c.onEvent == nil || r.Mode.isIntent() {
+		return
+	}
+	c.onEvent(eventType, c.Key, r)
+}
+
+// Abort fails the waiting request with the error and removes it from the queue
+func (c *Channel) Abort(requestId string, err error) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	request, has := c.queueMap[requestId]
+	if !has {
+		return false
+	}
+	c.answer(request, err)
+	c.dispatch()
+
+	return true
+}
+
+// edges creates the wait-for edges from the waiting clients to the holder clients of the key
+func (c *Channel) edges() WaitForGraph {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	edges := make(WaitForGraph, 0)
+	for _, request := range c.queue {
+		if len(request.ClientId) == 0 {
+			continue
+		}
+
+		for _, holder := range c.holders {
+			if len(holder.ClientId) == 0 || strings.Compare(holder.ClientId, request.ClientId) == 0 {
+				continue
+			}
+			edges = append(edges, &WaitForEdge{
+				Key:    c.Key,
+				Waiter: request.ClientId,
+				Holder: holder.ClientId,
+			})
+		}
+	}
+
+	return edges
+}
+
+// holderIds returns the client identities of the holders of the key
+func (c *Channel) holderIds() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	clientIds := make([]string, 0, len(c.holders))
+	for _, holder := range c.holders {
+		if len(holder.ClientId) == 0 {
+			continue
+		}
+		clientIds = append(clientIds, holder.ClientId)
 	}
+	return clientIds
+}
+
+// waits checks if the waiter client has a request in the queue while the holder client holds the key
+func (c *Channel) waits(waiter string, holder string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	held := false
+	for _, request := range c.holders {
+		if strings.Compare(request.ClientId, holder) == 0 {
+			held = true
+			break
+		}
+	}
+	if !held {
+		return false
+	}
+
+	for _, request := range c.queue {
+		if strings.Compare(request.ClientId, waiter) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Leader returns the latest holder of the key, it is nil when the key is free
+func (c *Channel) Leader() *Request {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.Latest == nil {
+		return nil
+	}
+	return c.Latest.snapshot()
+}
+
+// Position returns the place of the client on the key, the number of the waiting requests and the number of the
+// waiting requests that a new request with the priority would wait behind. 0 is for a holder, 1 and above is for the
+// place in the queue and -1 is for a client that is not on the key
+func (c *Channel) Position(clientId string, priority uint8) (int, int, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ahead := sort.Search(len(c.queue), func(i int) bool { return c.queue[i].Priority < priority })
+
+	if len(clientId) == 0 {
+		return -1, len(c.queue), ahead
+	}
+
+	for _, holder := range c.holders {
+		if strings.Compare(holder.ClientId, clientId) == 0 {
+			return 0, len(c.queue), ahead
+		}
+	}
+
+	for i, request := range c.queue {
+		if strings.Compare(request.ClientId, clientId) == 0 {
+			return i + 1, len(c.queue), ahead
+		}
+	}
+
+	return -1, len(c.queue), ahead
+}
+
+// idle checks if the key has neither holders nor waiting requests
+func (c *Channel) idle() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.holders) == 0 && len(c.queueMap) == 0 && len(c.waiters) == 0
 }
 
 func (c *Channel) Report() *ChannelReport {
-	if len(c.mutexChan) == 0 || c.Latest == nil {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.holders) == 0 {
 		return nil
 	}
+
+	mode := c.Latest.Mode
+	holders := make([]*HolderReport, 0, len(c.holders))
+	for _, holder := range c.holders {
+		if !holder.Mode.isIntent() { // Key is reported as intent only when it is held by intents alone
+			mode = holder.Mode
+		}
+		holders = append(holders, &HolderReport{
+			Request: holder.snapshot(),
+			Expires: holder.expires,
+		})
+	}
+	sort.Slice(holders, func(i, j int) bool { return holders[i].Request.Fence < holders[j].Request.Fence })
+
+	queue := make([]*WaiterReport, 0, len(c.queue))
+	for _, request := range c.queue {
+		queue = append(queue, &WaiterReport{
+			Request: request.snapshot(),
+			Queued:  request.queued,
+		})
+	}
+
 	return &ChannelReport{
 		Key:     c.Key,
-		Current: c.Latest,
+		Mode:    mode,
+		Permits: c.permits,
+		Fence:   c.fence,
+		Holders: holders,
+		Queue:   queue,
 	}
 }
 
 func (c *Channel) Reset(sourceAddr string) {
-	c.queueLock.Lock()
-	defer c.queueLock.Unlock()
+	c.drop(func(r *Request) bool { return strings.Compare(r.SourceAddr, sourceAddr) == 0 })
+}
 
-	resettingRequestIds := make([]string, 0)
-	for requestId, request := range c.queueMap {
-		if strings.Compare(request.SourceAddr, sourceAddr) != 0 {
+// ResetBySession drops the waiting requests and releases the holders that are bound to the session
+func (c *Channel) ResetBySession(sessionId string) {
+	c.drop(func(r *Request) bool { return strings.Compare(r.Session, sessionId) == 0 })
+}
+
+func (c *Channel) drop(match func(r *Request) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, request := range c.queueMap {
+		if !match(request) {
 			continue
 		}
-		resettingRequestIds = append(resettingRequestIds, requestId)
+		c.answer(request, ErrDropped)
 	}
 
-	for len(resettingRequestIds) > 0 {
-		delete(c.queueMap, resettingRequestIds[0])
-		resettingRequestIds = resettingRequestIds[1:]
+	for _, holder := range c.holders {
+		if !match(holder) {
+			continue
+		}
+		c.release(holder, EventReset)
 	}
 
-	if c.Latest != nil && strings.Compare(c.Latest.SourceAddr, sourceAddr) == 0 {
-		c.Pull()
+	waiters := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if !match(waiter) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		waiter.ready <- ErrDropped
 	}
+	c.waiters = waiters
+
+	c.dispatch()
 }
 
-func (c *Channel) Close() {
-	c.queueLock.Lock()
-	defer c.queueLock.Unlock()
+// Close drops the queue and the holders of the channel and returns the last fencing token of the channel
+func (c *Channel) Close() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+
+	for _, request := range c.queueMap {
+		c.answer(request, ErrReset)
+	}
+
+	for _, holder := range c.holders {
+		c.release(holder, EventReset)
+	}
+
+	for _, waiter := range c.waiters {
+		waiter.ready <- ErrReset
+	}
+	c.waiters = c.waiters[:0]
 
-	c.queueMap = make(map[string]*Request)
-	close(c.mutexChan)
+	return c.fence
 }
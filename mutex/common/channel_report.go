@@ -1,10 +1,27 @@
 package common
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 type ChannelReport struct {
 	Key     string
-	Current *Request
+	Mode    Mode
+	Permits uint16
+	Fence   uint64
+	Holders []*HolderReport
+	Queue   []*WaiterReport
+}
+
+type HolderReport struct {
+	Request *Request
+	Expires time.Time
+}
+
+type WaiterReport struct {
+	Request *Request
+	Queued  time.Time
 }
 
 type ChannelReports []*ChannelReport
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newModeRequest(clientId string, mode Mode) *Request {
+	request := newClientRequest(clientId)
+	request.Mode = mode
+	return request
+}
+
+// pushAsync pushes the request in the background and waits until it is granted or queued
+func pushAsync(t *testing.T, c *Channel, r *Request) chan error {
+	result := make(chan error, 1)
+	go func() { result <- c.Push(context.Background(), r) }()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if position, _, _ := c.Position(r.ClientId, 0); position >= 0 {
+			return result
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s is neither granted nor queued", r.ClientId)
+	return nil
+}
+
+func expectGranted(t *testing.T, result chan error, name string) {
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("%s is not granted: %v", name, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s is not granted in time", name)
+	}
+}
+
+func expectWaiting(t *testing.T, result chan error, name string) {
+	select {
+	case err := <-result:
+		t.Fatalf("%s is answered while it should wait: %v", name, err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestChannelQueuesReaderBehindWaitingWriter(t *testing.T) {
+	c := NewChannel("key")
+
+	reader := newModeRequest("reader", ModeShared)
+	expectGranted(t, pushAsync(t, c, reader), "reader")
+
+	writer := newModeRequest("writer", ModeExclusive)
+	writerResult := pushAsync(t, c, writer)
+	expectWaiting(t, writerResult, "writer")
+
+	// Late readers are compatible with the holder but they do not pass the waiting writer
+	lateReaders := make([]chan error, 0)
+	for _, clientId := range []string{"late-1", "late-2"} {
+		lateReader := newModeRequest(clientId, ModeShared)
+		lateReaders = append(lateReaders, pushAsync(t, c, lateReader))
+	}
+	for _, result := range lateReaders {
+		expectWaiting(t, result, "late reader")
+	}
+
+	if err := c.Pull(reader.Id); err != nil {
+		t.Fatal(err)
+	}
+	expectGranted(t, writerResult, "writer")
+	for _, result := range lateReaders {
+		expectWaiting(t, result, "late reader")
+	}
+
+	if err := c.Pull(writer.Id); err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range lateReaders {
+		expectGranted(t, result, "late reader")
+	}
+}
+
+// expectGrantOrder releases the holder and each granted waiter in turn and checks that the waiters take the key in
+// the given order
+func expectGrantOrder(t *testing.T, c *Channel, holder *Request, waiters []*Request, results []chan error) {
+	current := holder
+	for i, waiter := range waiters {
+		if err := c.Pull(current.Id); err != nil {
+			t.Fatal(err)
+		}
+		expectGranted(t, results[i], waiter.ClientId)
+
+		for j := i + 1; j < len(results); j++ {
+			expectWaiting(t, results[j], waiters[j].ClientId)
+		}
+		current = waiter
+	}
+}
+
+func TestChannelGrantsInArrivalOrder(t *testing.T) {
+	c := NewChannel("key")
+
+	holder := newModeRequest("holder", ModeExclusive)
+	expectGranted(t, pushAsync(t, c, holder), "holder")
+
+	waiters := make([]*Request, 0)
+	results := make([]chan error, 0)
+	for _, clientId := range []string{"first", "second", "third", "fourth"} {
+		waiter := newModeRequest(clientId, ModeExclusive)
+		waiters = append(waiters, waiter)
+		results = append(results, pushAsync(t, c, waiter))
+	}
+
+	expectGrantOrder(t, c, holder, waiters, results)
+
+	for i := 1; i < len(waiters); i++ {
+		if waiters[i].Fence <= waiters[i-1].Fence {
+			t.Fatalf("fencing token of %s is not greater than %s", waiters[i].ClientId, waiters[i-1].ClientId)
+		}
+	}
+}
+
+func TestChannelGrantsHigherPriorityFirst(t *testing.T) {
+	c := NewChannel("key")
+
+	holder := newModeRequest("holder", ModeExclusive)
+	expectGranted(t, pushAsync(t, c, holder), "holder")
+
+	priorities := map[string]uint8{"low": 1, "high": 5, "middle": 3, "late-high": 5}
+
+	requests := make(map[string]*Request)
+	results := make(map[string]chan error)
+	for _, clientId := range []string{"low", "high", "middle", "late-high"} {
+		waiter := newModeRequest(clientId, ModeExclusive)
+		waiter.Priority = priorities[clientId]
+
+		requests[clientId] = waiter
+		results[clientId] = pushAsync(t, c, waiter)
+	}
+
+	// Same priority keeps the arrival order
+	waiters := make([]*Request, 0)
+	orderedResults := make([]chan error, 0)
+	for _, clientId := range []string{"high", "late-high", "middle", "low"} {
+		waiters = append(waiters, requests[clientId])
+		orderedResults = append(orderedResults, results[clientId])
+	}
+
+	expectGrantOrder(t, c, holder, waiters, orderedResults)
+}
+
+func TestChannelExpiredLeaseGrantsNextWaiter(t *testing.T) {
+	c := NewChannel("key")
+
+	holder := newModeRequest("holder", ModeExclusive)
+	holder.Lease = 50 * time.Millisecond
+	expectGranted(t, pushAsync(t, c, holder), "holder")
+
+	waiter := newModeRequest("waiter", ModeExclusive)
+	result := pushAsync(t, c, waiter)
+	expectWaiting(t, result, "waiter")
+
+	expectGranted(t, result, "waiter")
+
+	if err := c.Pull(holder.Id); err == nil {
+		t.Fatal("holder unlocks the key after its lease is expired")
+	}
+	if err := c.Pull(waiter.Id); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,17 @@
+package common
+
+import "fmt"
+
+var ErrReset = fmt.Errorf("key is reset while waiting")
+var ErrDropped = fmt.Errorf("request is dropped by reset while waiting")
+var ErrBusy = fmt.Errorf("key is busy")
+var ErrSession = fmt.Errorf("session is not alive")
+var ErrPermits = fmt.Errorf("key is in use with a different permit count")
+var ErrUpgrade = fmt.Errorf("holder can not reenter the key with a stronger mode")
+var ErrNested = fmt.Errorf("keys of the request should not be nested in each other")
+var ErrDeadlock = fmt.Errorf("request is chosen as the victim of a deadlock")
+var ErrParties = fmt.Errorf("barrier is in use with a different party count")
+var ErrReentered = fmt.Errorf("reentered holder can not wait for a signal on the key")
+var ErrNoLatch = fmt.Errorf("latch is not defined for the key")
+var ErrLatchExists = fmt.Errorf("latch of the key is still counting down")
+var ErrNotHolder = fmt.Errorf("request is not the holder of the key")
@@ -0,0 +1,33 @@
+package common
+
+import "time"
+
+type EventType byte
+
+var (
+	EventAcquired EventType = 1
+	EventReleased EventType = 2
+	EventExpired  EventType = 3
+	EventReset    EventType = 4
+)
+
+// Event tells the change of the holders of a key to the watchers
+type Event struct {
+	Type       EventType
+	Key        string
+	Stamp      time.Time
+	SourceAddr string
+	ClientId   string
+	Fence      uint64
+}
+
+func newEvent(eventType EventType, key string, r *Request) *Event {
+	return &Event{
+		Type:       eventType,
+		Key:        key,
+		Stamp:      time.Now().UTC(),
+		SourceAddr: r.SourceAddr,
+		ClientId:   r.ClientId,
+		Fence:      r.Fence,
+	}
+}
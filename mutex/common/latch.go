@@ -0,0 +1,124 @@
+package common
+
+import (
+	"context"
+	"sync"
+)
+
+// Latch blocks the waiting requests on the key until it is counted down to zero. It is a one-shot gate, once it is
+// open the waiting requests pass without waiting
+type Latch struct {
+	Key string
+
+	mutex     sync.Mutex
+	count     uint32
+	remaining uint32
+	waiters   []*Request
+
+	onOpen func(l *Latch) // Called when the latch is counted down to zero, should not block
+}
+
+func NewLatch(key string, count uint32) *Latch {
+	return &Latch{
+		Key:       key,
+		mutex:     sync.Mutex{},
+		count:     count,
+		remaining: count,
+		waiters:   make([]*Request, 0),
+	}
+}
+
+// CountDown decreases the remaining count and opens the latch when it reaches zero. It returns the remaining count
+func (l *Latch) CountDown() uint32 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.remaining == 0 {
+		return 0
+	}
+
+	l.remaining--
+	if l.remaining > 0 {
+		return l.remaining
+	}
+
+	for _, waiter := range l.waiters {
+		waiter.ready <- nil
+	}
+	l.waiters = make([]*Request, 0)
+
+	if l.onOpen != nil {
+		l.onOpen(l)
+	}
+
+	return 0
+}
+
+// Wait waits until the latch is open or the context is done. When the context is done, the request stops waiting
+func (l *Latch) Wait(ctx context.Context, r *Request) error {
+	l.mutex.Lock()
+
+	if l.remaining == 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+
+	r.ready = make(chan error, 1)
+	l.waiters = append(l.waiters, r)
+	l.mutex.Unlock()
+
+	select {
+	case err := <-r.ready:
+		return err
+	case <-ctx.Done():
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		if !l.leave(r) { // Latch is opened at the same time
+			return <-r.ready
+		}
+		return ctx.Err()
+	}
+}
+
+func (l *Latch) leave(r *Request) bool {
+	for i := range l.waiters {
+		if l.waiters[i] != r {
+			continue
+		}
+		l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// open checks if the latch is counted down to zero
+func (l *Latch) open() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.remaining == 0
+}
+
+// Close drops the waiting requests of the latch
+func (l *Latch) Close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, waiter := range l.waiters {
+		waiter.ready <- ErrReset
+	}
+	l.waiters = make([]*Request, 0)
+}
+
+func (l *Latch) Report() *LatchReport {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return &LatchReport{
+		Key:       l.Key,
+		Count:     l.count,
+		Remaining: l.remaining,
+		Waiting:   uint32(len(l.waiters)),
+	}
+}
@@ -0,0 +1,16 @@
+package common
+
+import "strings"
+
+type LatchReport struct {
+	Key       string
+	Count     uint32
+	Remaining uint32
+	Waiting   uint32
+}
+
+type LatchReports []*LatchReport
+
+func (l LatchReports) Len() int           { return len(l) }
+func (l LatchReports) Less(i, j int) bool { return strings.Compare(l[i].Key, l[j].Key) < 0 }
+func (l LatchReports) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
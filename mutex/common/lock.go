@@ -1,80 +1,330 @@
 package common
 
 import (
-	"net"
+	"context"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Lock struct {
-	mutex    *sync.Mutex
-	channels map[string]*Channel
+	shards    []*shard
+	separator string // Separates the path segments of the keys in hierarchical mode, empty keeps the keys flat
+
+	mutex    *sync.Mutex // Guards the sessions, the barriers and the latches
+	sessions map[string]bool
+	barriers map[string]*Barrier
+	latches  map[string]*Latch
+
+	waitMutex *sync.Mutex               // Guards the keys that the clients wait for
+	waiting   map[string]map[string]int // Client identity to the keys it waits for with the number of its requests
+
+	watchMutex *sync.Mutex  // Guards the changes of the watchers
+	watchers   atomic.Value // []*Watcher, replaced on each change, so the events are sent without locking
+	watching   int32        // Number of the watchers, events are not created while there is none
 }
 
 func NewLock() *Lock {
-	return &Lock{
+	return newLock(defaultShards)
+}
+
+func newLock(shards int) *Lock {
+	l := &Lock{
+		shards:   make([]*shard, shards),
 		mutex:    &sync.Mutex{},
-		channels: make(map[string]*Channel),
+		sessions: make(map[string]bool),
+		barriers: make(map[string]*Barrier),
+		latches:  make(map[string]*Latch),
+
+		waitMutex: &sync.Mutex{},
+		waiting:   make(map[string]map[string]int),
+
+		watchMutex: &sync.Mutex{},
+	}
+	l.watchers.Store(make([]*Watcher, 0))
+	for i := range l.shards {
+		l.shards[i] = newShard()
 	}
+	return l
+}
+
+// NewHierarchicalLock creates the lock that handles the keys as paths. Locking a key conflicts with the locks on
+// its ancestors and descendants
+func NewHierarchicalLock(separator string) *Lock {
+	l := NewLock()
+	l.separator = separator
+	return l
 }
 
+// channel returns the channel of the key, creating it if it does not exist. The channel is kept in the map until
+// it is given back using done
 func (l *Lock) channel(key string) *Channel {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	s := l.shard(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, has := s.channels[key]; !has {
+		channel := NewChannel(key)
+		channel.fence = s.fence
+		channel.onWait = l.detect
+		channel.onQueue = l.queued
+		channel.onRelease = func(r *Request) { l.releaseIntents(r.intents) }
+		channel.onIdle = l.idle
+		channel.onEvent = l.notify
+		s.channels[key] = channel
+	}
+
+	channel := s.channels[key]
+	channel.users++
+
+	return channel
+}
+
+// done gives the channel back and removes it from the map if nobody uses it and the key is idle
+func (l *Lock) done(channel *Channel) {
+	s := l.shard(channel.Key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channel.users--
+	s.collect(channel)
+}
+
+// idle removes the channel that is left idle by an expired lease
+func (l *Lock) idle(channel *Channel) {
+	s := l.shard(channel.Key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collect(channel)
+}
+
+func (l *Lock) push(ctx context.Context, key string, request *Request) error {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Push(ctx, request)
+}
+
+func (l *Lock) tryPush(key string, request *Request) error {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.TryPush(request)
+}
+
+func (l *Lock) Lock(ctx context.Context, key string, request *Request) error {
+	if !l.alive(request.Session) {
+		return ErrSession
+	}
 
-	if _, has := l.channels[key]; !has {
-		l.channels[key] = NewChannel(key)
+	intents, err := l.lockIntents(ctx, key, request)
+	if err != nil {
+		return err
 	}
+	request.intents = intents
 
-	return l.channels[key]
+	if err := l.push(ctx, key, request); err != nil {
+		l.releaseIntents(request.intents)
+		return err
+	}
+
+	if request.reentered { // Holder already has the intents
+		l.releaseIntents(request.intents)
+	}
+
+	if !l.alive(request.Session) { // Session is closed while waiting
+		_ = l.Unlock(key, request.Id)
+		return ErrSession
+	}
+
+	return nil
 }
 
-func (l *Lock) Lock(key string, sourceAddr string, remoteAddr net.Addr) (locked bool) {
-	defer func() {
-		if r := recover(); r != nil {
-			locked = false
+// LockAll locks all the keys or none of them. Keys are locked in sorted order, so the requests that lock the same
+// keys can not deadlock each other. It returns the granted request of each key
+func (l *Lock) LockAll(ctx context.Context, keys []string, request *Request) (map[string]*Request, error) {
+	sortedKeys := make([]string, len(keys))
+	copy(sortedKeys, keys)
+	sort.Strings(sortedKeys)
+
+	if l.nested(sortedKeys) {
+		return nil, ErrNested
+	}
+
+	requests := make(map[string]*Request)
+	for _, key := range sortedKeys {
+		if _, has := requests[key]; has {
+			continue
 		}
-	}() // Handle in case of reset
-	l.channel(key).Push(NewRequest(sourceAddr, remoteAddr))
-	return true
+
+		keyRequest := request.clone()
+
+		err := l.Lock(ctx, key, keyRequest)
+		for err == ErrReset {
+			err = l.Lock(ctx, key, keyRequest)
+		}
+
+		if err != nil {
+			for lockedKey, lockedRequest := range requests {
+				_ = l.Unlock(lockedKey, lockedRequest.Id)
+			}
+			return nil, err
+		}
+
+		requests[key] = keyRequest
+	}
+
+	return requests, nil
 }
 
-func (l *Lock) Unlock(key string) {
-	l.channel(key).Pull()
+// TryLock locks the key only if it is free at the moment. If the key is not free, ErrBusy is returned
+func (l *Lock) TryLock(key string, request *Request) error {
+	if !l.alive(request.Session) {
+		return ErrSession
+	}
+
+	intents, err := l.tryLockIntents(key, request)
+	if err != nil {
+		return err
+	}
+	request.intents = intents
+
+	if err := l.tryPush(key, request); err != nil {
+		l.releaseIntents(request.intents)
+		return err
+	}
+
+	if request.reentered { // Holder already has the intents
+		l.releaseIntents(request.intents)
+	}
+
+	if !l.alive(request.Session) { // Session is closed at the same time
+		_ = l.Unlock(key, request.Id)
+		return ErrSession
+	}
+
+	return nil
+}
+
+func (l *Lock) Renew(key string, token string, lease time.Duration) error {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Renew(token, lease)
+}
+
+func (l *Lock) Unlock(key string, token string) error {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Pull(token)
+}
+
+// Wait releases the key of the holder until a signal arrives on the key and takes it back. If the wait fails, the
+// request does not hold the key anymore
+func (l *Lock) Wait(ctx context.Context, key string, token string) (*Request, error) {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	request, err := channel.Wait(ctx, token)
+	if err != nil && request != nil {
+		l.releaseIntents(request.intents)
+	}
+	return request, err
+}
+
+// Signal wakes up the oldest waiter of the key, or all of them if it is a broadcast
+func (l *Lock) Signal(key string, broadcast bool) int {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Signal(broadcast)
+}
+
+// Leader returns the holder of the election key, it is nil when there is no leader
+func (l *Lock) Leader(key string) *Request {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Leader()
+}
+
+// Position returns the place of the client on the key, the number of the waiting requests and the number of the
+// waiting requests that a new request with the priority would wait behind
+func (l *Lock) Position(key string, clientId string, priority uint8) (int, int, int) {
+	channel := l.channel(key)
+	defer l.done(channel)
+
+	return channel.Position(clientId, priority)
 }
 
 func (l *Lock) ResetByKey(key string) {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	l.resetLatch(key)
+
+	s := l.shard(key)
 
-	channel, has := l.channels[key]
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channel, has := s.channels[key]
 	if !has {
 		return
 	}
-	channel.Close()
-	delete(l.channels, key)
+	s.remove(channel)
 }
 
+// ResetBySource drops the waiting requests and releases the holders of the source. Shards are visited one by one
+// and the channels are reset outside the shard locks, so the lock traffic goes on during the reset
 func (l *Lock) ResetBySource(sourceAddr string) {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	for _, s := range l.shards {
+		channels := s.snapshot()
+		for _, channel := range channels {
+			channel.Reset(sourceAddr)
+		}
+		s.sweep(channels)
+	}
+}
 
-	for _, channel := range l.channels {
-		channel.Reset(sourceAddr)
+// WaitFor creates the graph of the clients that are waiting for the keys held by other clients. Only the requests
+// that have client identity take place in the graph
+func (l *Lock) WaitFor() WaitForGraph {
+	graph := make(WaitForGraph, 0)
+	for _, s := range l.shards {
+		for _, channel := range s.snapshot() {
+			graph = append(graph, channel.edges()...)
+		}
 	}
+	sort.Sort(graph)
+
+	return graph
 }
 
-func (l *Lock) Keys() ChannelReports {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+// Channels returns the number of the live channels in the map
+func (l *Lock) Channels() int {
+	count := 0
+	for _, s := range l.shards {
+		s.mutex.Lock()
+		count += len(s.channels)
+		s.mutex.Unlock()
+	}
+	return count
+}
 
+func (l *Lock) Keys() ChannelReports {
 	reports := make(ChannelReports, 0)
-	for k := range l.channels {
-		report := l.channels[k].Report()
-		if report == nil {
-			continue
+	for _, s := range l.shards {
+		for _, channel := range s.snapshot() {
+			report := channel.Report()
+			if report == nil {
+				continue
+			}
+			reports = append(reports, report)
 		}
-		reports = append(reports, report)
 	}
 	sort.Sort(reports)
 
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"context"
+	"sort"
+)
+
+// barrier returns the barrier of the key, creating it if it does not exist. The barrier is kept in the map until
+// it is given back using doneBarrier
+func (l *Lock) barrier(key string) *Barrier {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, has := l.barriers[key]; !has {
+		l.barriers[key] = NewBarrier(key)
+	}
+
+	barrier := l.barriers[key]
+	barrier.users++
+
+	return barrier
+}
+
+// doneBarrier gives the barrier back and removes it from the map if nobody waits at it
+func (l *Lock) doneBarrier(barrier *Barrier) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	barrier.users--
+	if barrier.users > 0 || l.barriers[barrier.Key] != barrier || !barrier.idle() {
+		return
+	}
+	delete(l.barriers, barrier.Key)
+}
+
+// Arrive waits at the barrier of the key until the number of parties arrive
+func (l *Lock) Arrive(ctx context.Context, key string, request *Request, parties uint16) error {
+	barrier := l.barrier(key)
+	defer l.doneBarrier(barrier)
+
+	return barrier.Arrive(ctx, request, parties)
+}
+
+func (l *Lock) Barriers() BarrierReports {
+	l.mutex.Lock()
+	barriers := make([]*Barrier, 0, len(l.barriers))
+	for _, barrier := range l.barriers {
+		barriers = append(barriers, barrier)
+	}
+	l.mutex.Unlock()
+
+	reports := make(BarrierReports, 0)
+	for _, barrier := range barriers {
+		report := barrier.Report()
+		if report == nil {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Sort(reports)
+
+	return reports
+}
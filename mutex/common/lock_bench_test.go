@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	benchmarkKeys     = 4096
+	benchmarkHeldKeys = 10000
+)
+
+// benchmarkLock locks and unlocks the keys from parallel goroutines while the background work runs on the lock.
+// The table is filled with the held keys of another source first, so the background work walks a busy table
+func benchmarkLock(b *testing.B, shards int, background func(l *Lock)) {
+	l := newLock(shards)
+	ctx := context.Background()
+
+	for i := 0; i < benchmarkHeldKeys; i++ {
+		if err := l.Lock(ctx, "held-"+strconv.Itoa(i), NewRequest("10.0.0.2", nil)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	keys := make([]string, benchmarkKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	quit := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	if background != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-quit:
+					return
+				default:
+					background(l)
+				}
+			}
+		}()
+	}
+
+	var next uint64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := keys[atomic.AddUint64(&next, 1)%benchmarkKeys]
+
+			request := NewRequest("127.0.0.1", nil)
+			if err := l.Lock(ctx, key, request); err != nil {
+				b.Error(err)
+				return
+			}
+			if err := l.Unlock(key, request.Id); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	b.StopTimer()
+	close(quit)
+	wg.Wait()
+}
+
+func BenchmarkLockSingleShard(b *testing.B) {
+	benchmarkLock(b, 1, nil)
+}
+
+func BenchmarkLockSharded(b *testing.B) {
+	benchmarkLock(b, defaultShards, nil)
+}
+
+func BenchmarkLockWithResetSingleShard(b *testing.B) {
+	benchmarkLock(b, 1, func(l *Lock) { l.ResetBySource("10.0.0.1") })
+}
+
+func BenchmarkLockWithResetSharded(b *testing.B) {
+	benchmarkLock(b, defaultShards, func(l *Lock) { l.ResetBySource("10.0.0.1") })
+}
+
+func BenchmarkLockWithKeysSingleShard(b *testing.B) {
+	benchmarkLock(b, 1, func(l *Lock) { l.Keys() })
+}
+
+func BenchmarkLockWithKeysSharded(b *testing.B) {
+	benchmarkLock(b, defaultShards, func(l *Lock) { l.Keys() })
+}
+
+// lockedWalk visits the channels holding the table locks during the whole walk, the way the table was walked before
+// it was sharded and snapshotted. It is the baseline for the background work
+func lockedWalk(l *Lock, visit func(channel *Channel)) {
+	for _, s := range l.shards {
+		s.mutex.Lock()
+	}
+	for _, s := range l.shards {
+		for _, channel := range s.channels {
+			visit(channel)
+		}
+	}
+	for _, s := range l.shards {
+		s.mutex.Unlock()
+	}
+}
+
+func BenchmarkLockWithLockedResetBaseline(b *testing.B) {
+	benchmarkLock(b, 1, func(l *Lock) {
+		lockedWalk(l, func(channel *Channel) { channel.Reset("10.0.0.1") })
+	})
+}
+
+func BenchmarkLockWithLockedKeysBaseline(b *testing.B) {
+	benchmarkLock(b, 1, func(l *Lock) {
+		reports := make(ChannelReports, 0)
+		lockedWalk(l, func(channel *Channel) {
+			if report := channel.Report(); report != nil {
+				reports = append(reports, report)
+			}
+		})
+		sort.Sort(reports)
+	})
+}
@@ -0,0 +1,131 @@
+package common
+
+import "strings"
+
+// queued keeps the keys that the clients wait for while their requests enter and leave the queues, so the deadlock
+// detection follows the waits of a client without visiting the whole table
+func (l *Lock) queued(key string, r *Request, waiting bool) {
+	if len(r.ClientId) == 0 {
+		return
+	}
+
+	l.waitMutex.Lock()
+	defer l.waitMutex.Unlock()
+
+	keys, has := l.waiting[r.ClientId]
+	if waiting {
+		if !has {
+			keys = make(map[string]int)
+			l.waiting[r.ClientId] = keys
+		}
+		keys[key]++
+		return
+	}
+
+	if keys[key] > 1 {
+		keys[key]--
+		return
+	}
+	delete(keys, key)
+
+	if len(keys) == 0 {
+		delete(l.waiting, r.ClientId)
+	}
+}
+
+// waitingKeys returns the keys that the client waits for at the moment
+func (l *Lock) waitingKeys(clientId string) []string {
+	l.waitMutex.Lock()
+	defer l.waitMutex.Unlock()
+
+	keys := make([]string, 0, len(l.waiting[clientId]))
+	for key := range l.waiting[clientId] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// existing returns the channel of the key without creating it, nil is returned when the key is idle
+func (l *Lock) existing(key string) *Channel {
+	s := l.shard(key)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.channels[key]
+}
+
+// detect fails the waiting request as the victim when its wait closes a cycle in the wait-for graph. The request
+// that closes the cycle is the youngest one in it, so the older requests keep their places
+func (l *Lock) detect(channel *Channel, request *Request) {
+	if len(request.ClientId) == 0 {
+		return
+	}
+
+	path := l.cycle(request.ClientId, channel.Key)
+	if path == nil || !l.verify(path) {
+		return
+	}
+	channel.Abort(request.Id, ErrDeadlock)
+}
+
+// cycle follows the waits from the holders of the key that the client waits for and returns the path of the waits
+// that leads back to the client, nil is returned when there is no cycle
+func (l *Lock) cycle(clientId string, key string) WaitForGraph {
+	paths := make([]WaitForGraph, 0)
+	paths = l.follow(paths, nil, clientId, key)
+
+	visited := make(map[string]bool)
+	for len(paths) > 0 {
+		path := paths[len(paths)-1]
+		paths = paths[:len(paths)-1]
+
+		current := path[len(path)-1].Holder
+		if strings.Compare(current, clientId) == 0 {
+			return path
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		for _, waitingKey := range l.waitingKeys(current) {
+			paths = l.follow(paths, path, current, waitingKey)
+		}
+	}
+
+	return nil
+}
+
+// follow adds the paths that continue with the waits of the client for the holders of the key
+func (l *Lock) follow(paths []WaitForGraph, path WaitForGraph, clientId string, key string) []WaitForGraph {
+	channel := l.existing(key)
+	if channel == nil {
+		return paths
+	}
+
+	for _, holder := range channel.holderIds() {
+		if strings.Compare(holder, clientId) == 0 {
+			continue
+		}
+
+		next := make(WaitForGraph, len(path), len(path)+1)
+		copy(next, path)
+		next = append(next, &WaitForEdge{Key: key, Waiter: clientId, Holder: holder})
+
+		paths = append(paths, next)
+	}
+	return paths
+}
+
+// verify checks the waits of the path once more. The keys of the path are visited one by one, so a wait that ends
+// while the path is followed should not make a cycle that does not exist. A real deadlock stays until a victim leaves
+func (l *Lock) verify(path WaitForGraph) bool {
+	for _, edge := range path {
+		channel := l.existing(edge.Key)
+		if channel == nil || !channel.waits(edge.Waiter, edge.Holder) {
+			return false
+		}
+	}
+	return true
+}
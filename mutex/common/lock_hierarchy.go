@@ -0,0 +1,89 @@
+package common
+
+import (
+	"context"
+	"strings"
+)
+
+// ancestors returns the ancestor keys of the hierarchical key from the root to the parent
+func (l *Lock) ancestors(key string) []string {
+	ancestors := make([]string, 0)
+	if len(l.separator) == 0 {
+		return ancestors
+	}
+
+	for i := 1; i < len(key); i++ {
+		if !strings.HasPrefix(key[i:], l.separator) {
+			continue
+		}
+		ancestors = append(ancestors, key[:i])
+	}
+
+	return ancestors
+}
+
+// nested checks if any of the hierarchical keys is an ancestor of another one. The intent of the descendant would wait
+// for the lock of the same request on the ancestor
+func (l *Lock) nested(keys []string) bool {
+	if len(l.separator) == 0 {
+		return false
+	}
+
+	keySet := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keySet[key] = true
+	}
+
+	for _, key := range keys {
+		for _, ancestor := range l.ancestors(key) {
+			if keySet[ancestor] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lockIntents takes the intents of the request on the ancestors of the key from the root to the parent, so the
+// requests on the same path can not deadlock each other
+func (l *Lock) lockIntents(ctx context.Context, key string, request *Request) (map[string]*Request, error) {
+	intents := make(map[string]*Request)
+	for _, ancestor := range l.ancestors(key) {
+		intent := request.intent()
+
+		err := l.push(ctx, ancestor, intent)
+		for err == ErrReset {
+			err = l.push(ctx, ancestor, intent)
+		}
+
+		if err != nil {
+			l.releaseIntents(intents)
+			return nil, err
+		}
+
+		intents[ancestor] = intent
+	}
+	return intents, nil
+}
+
+func (l *Lock) tryLockIntents(key string, request *Request) (map[string]*Request, error) {
+	intents := make(map[string]*Request)
+	for _, ancestor := range l.ancestors(key) {
+		intent := request.intent()
+
+		if err := l.tryPush(ancestor, intent); err != nil {
+			l.releaseIntents(intents)
+			return nil, err
+		}
+
+		intents[ancestor] = intent
+	}
+	return intents, nil
+}
+
+// releaseIntents releases the intents that are taken on the ancestors of a key
+func (l *Lock) releaseIntents(intents map[string]*Request) {
+	for ancestor, intent := range intents {
+		_ = l.Unlock(ancestor, intent.Id)
+	}
+}
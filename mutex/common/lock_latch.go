@@ -0,0 +1,107 @@
+package common
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// latchGrace is the time that an open latch stays, so the late waiters still pass through it
+const latchGrace = 10 * time.Minute
+
+// CreateLatch creates the latch of the key with the count. Open latch of the key is replaced with the new one, so
+// the key can be used for the next gate
+func (l *Lock) CreateLatch(key string, count uint32) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if latch, has := l.latches[key]; has && !latch.open() {
+		return ErrLatchExists
+	}
+
+	latch := NewLatch(key, count)
+	latch.onOpen = func(latch *Latch) {
+		time.AfterFunc(latchGrace, func() { l.removeLatch(key, latch) })
+	}
+	l.latches[key] = latch
+
+	return nil
+}
+
+// removeLatch removes the open latch of the key unless it is already replaced with a new one
+func (l *Lock) removeLatch(key string, latch *Latch) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.latches[key] != latch {
+		return
+	}
+	delete(l.latches, key)
+}
+
+func (l *Lock) latch(key string) (*Latch, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	latch, has := l.latches[key]
+	if !has {
+		return nil, ErrNoLatch
+	}
+	return latch, nil
+}
+
+// CountDown decreases the count of the latch of the key and returns the remaining count
+func (l *Lock) CountDown(key string) (uint32, error) {
+	latch, err := l.latch(key)
+	if err != nil {
+		return 0, err
+	}
+	return latch.CountDown(), nil
+}
+
+// WaitLatch waits until the latch of the key is counted down to zero
+func (l *Lock) WaitLatch(ctx context.Context, key string, request *Request) error {
+	latch, err := l.latch(key)
+	if err != nil {
+		return err
+	}
+	return latch.Wait(ctx, request)
+}
+
+func (l *Lock) LatchStatus(key string) (*LatchReport, error) {
+	latch, err := l.latch(key)
+	if err != nil {
+		return nil, err
+	}
+	return latch.Report(), nil
+}
+
+// resetLatch drops the latch of the key with its waiting requests
+func (l *Lock) resetLatch(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	latch, has := l.latches[key]
+	if !has {
+		return
+	}
+	latch.Close()
+	delete(l.latches, key)
+}
+
+func (l *Lock) Latches() LatchReports {
+	l.mutex.Lock()
+	latches := make([]*Latch, 0, len(l.latches))
+	for _, latch := range l.latches {
+		latches = append(latches, latch)
+	}
+	l.mutex.Unlock()
+
+	reports := make(LatchReports, 0, len(latches))
+	for _, latch := range latches {
+		reports = append(reports, latch.Report())
+	}
+	sort.Sort(reports)
+
+	return reports
+}
@@ -0,0 +1,41 @@
+package common
+
+import "github.com/google/uuid"
+
+// OpenSession creates the session that the lock requests can be bound to
+func (l *Lock) OpenSession() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sessionId := uuid.NewString()
+	l.sessions[sessionId] = true
+
+	return sessionId
+}
+
+// CloseSession drops the waiting requests and releases the keys that are bound to the session
+func (l *Lock) CloseSession(sessionId string) {
+	l.mutex.Lock()
+	delete(l.sessions, sessionId)
+	l.mutex.Unlock()
+
+	for _, s := range l.shards {
+		channels := s.snapshot()
+		for _, channel := range channels {
+			channel.ResetBySession(sessionId)
+		}
+		s.sweep(channels)
+	}
+}
+
+// alive checks if the session is open. Requests without a session are always alive
+func (l *Lock) alive(sessionId string) bool {
+	if len(sessionId) == 0 {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.sessions[sessionId]
+}
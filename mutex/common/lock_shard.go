@@ -0,0 +1,69 @@
+package common
+
+import "sync"
+
+const defaultShards = 64
+
+// shard is a partition of the lock table. Keys are spread over the shards by their hash, so the calls on
+// unrelated keys do not wait for each other
+type shard struct {
+	mutex    sync.Mutex
+	channels map[string]*Channel
+	fence    uint64 // Highest fencing token of the removed channels to keep tokens monotonic on recreation
+}
+
+func newShard() *shard {
+	return &shard{
+		channels: make(map[string]*Channel),
+	}
+}
+
+// shard returns the partition of the key using FNV-1a hash
+func (l *Lock) shard(key string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return l.shards[hash%uint32(len(l.shards))]
+}
+
+// collect removes the channel if nobody uses it and the key is idle. It should be called holding the mutex, so
+// a call that starts to use the channel at the same moment gets a new channel for the key
+func (s *shard) collect(channel *Channel) {
+	if channel.users > 0 || s.channels[channel.Key] != channel || !channel.idle() {
+		return
+	}
+	s.remove(channel)
+}
+
+// remove closes the channel and deletes it from the map keeping its last fencing token. It should be called
+// holding the mutex
+func (s *shard) remove(channel *Channel) {
+	if fence := channel.Close(); fence > s.fence {
+		s.fence = fence
+	}
+	delete(s.channels, channel.Key)
+}
+
+// snapshot returns the channels of the shard at the moment, so they can be visited without blocking the shard
+func (s *shard) snapshot() []*Channel {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channels := make([]*Channel, 0, len(s.channels))
+	for _, channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// sweep removes the channels that are left idle after a reset
+func (s *shard) sweep(channels []*Channel) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, channel := range channels {
+		s.collect(channel)
+	}
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newClientRequest(clientId string) *Request {
+	request := NewRequest("127.0.0.1", nil)
+	request.ClientId = clientId
+	return request
+}
+
+// lockAsync locks the key in the background and answers the result of the lock to the returned channel
+func lockAsync(l *Lock, key string, request *Request) chan error {
+	result := make(chan error, 1)
+	go func() { result <- l.Lock(context.Background(), key, request) }()
+	return result
+}
+
+// waitQueued waits until the key has the given number of waiting requests
+func waitQueued(t *testing.T, l *Lock, key string, count int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, report := range l.Keys() {
+			if report.Key == key && len(report.Queue) == count {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s does not have %d waiting requests", key, count)
+}
+
+func TestLockDetectsDeadlockOnDispatch(t *testing.T) {
+	l := newLock(defaultShards)
+	ctx := context.Background()
+
+	a := newClientRequest("a")
+	if err := l.Lock(ctx, "k2", a); err != nil {
+		t.Fatal(err)
+	}
+	c := newClientRequest("c")
+	if err := l.Lock(ctx, "k1", c); err != nil {
+		t.Fatal(err)
+	}
+
+	bOnK1 := lockAsync(l, "k1", newClientRequest("b"))
+	waitQueued(t, l, "k1", 1)
+	aOnK1 := lockAsync(l, "k1", newClientRequest("a"))
+	waitQueued(t, l, "k1", 2)
+	bOnK2 := lockAsync(l, "k2", newClientRequest("b"))
+	waitQueued(t, l, "k2", 1)
+
+	// b takes k1 while a waits for it and b waits for k2 that is held by a
+	if err := l.Unlock("k1", c.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-bOnK1:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("k1 is not granted to b")
+	}
+
+	select {
+	case err := <-aOnK1:
+		if err != ErrDeadlock {
+			t.Fatalf("expected deadlock, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("deadlock is not detected")
+	}
+
+	if err := l.Unlock("k2", a.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-bOnK2:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("k2 is not granted to b")
+	}
+
+	if keys := l.waitingKeys("a"); len(keys) != 0 {
+		t.Fatalf("a still waits for %v", keys)
+	}
+	if keys := l.waitingKeys("b"); len(keys) != 0 {
+		t.Fatalf("b still waits for %v", keys)
+	}
+}
+
+func TestLockCollectsIdleChannelsWhileLocking(t *testing.T) {
+	l := newLock(defaultShards)
+	ctx := context.Background()
+
+	keys := []string{"k1", "k2", "k3"}
+	inside := make(map[string]*int32)
+	for _, key := range keys {
+		inside[key] = new(int32)
+	}
+
+	wg := &sync.WaitGroup{}
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				key := keys[(worker+i)%len(keys)]
+
+				request := NewRequest("127.0.0.1", nil)
+				if err := l.Lock(ctx, key, request); err != nil {
+					t.Error(err)
+					return
+				}
+
+				// A request that is pushed to a collected channel would hold the key together with another one
+				if atomic.AddInt32(inside[key], 1) != 1 {
+					t.Errorf("%s is held by more than one request", key)
+				}
+				atomic.AddInt32(inside[key], -1)
+
+				if err := l.Unlock(key, request.Id); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	if channels := l.Channels(); channels != 0 {
+		t.Fatalf("%d idle channels are left in the table", channels)
+	}
+}
@@ -0,0 +1,67 @@
+package common
+
+import "sync/atomic"
+
+// Watch starts to send the events of the key, or the keys that start with it as a prefix, to the watcher
+func (l *Lock) Watch(key string, prefix bool) *Watcher {
+	l.watchMutex.Lock()
+	defer l.watchMutex.Unlock()
+
+	watcher := newWatcher(key, prefix)
+
+	current := l.watchers.Load().([]*Watcher)
+	watchers := make([]*Watcher, 0, len(current)+1)
+	watchers = append(watchers, current...)
+	watchers = append(watchers, watcher)
+
+	l.watchers.Store(watchers)
+	atomic.StoreInt32(&l.watching, int32(len(watchers)))
+
+	return watcher
+}
+
+// Unwatch stops sending the events to the watcher and closes its events channel
+func (l *Lock) Unwatch(watcher *Watcher) {
+	l.watchMutex.Lock()
+	defer l.watchMutex.Unlock()
+
+	watcher.close()
+
+	current := l.watchers.Load().([]*Watcher)
+	watchers := make([]*Watcher, 0, len(current))
+	for _, w := range current {
+		if w == watcher {
+			continue
+		}
+		watchers = append(watchers, w)
+	}
+	if len(watchers) == len(current) {
+		return
+	}
+
+	l.watchers.Store(watchers)
+	atomic.StoreInt32(&l.watching, int32(len(watchers)))
+}
+
+// notify sends the event to the matching watchers without blocking the key. The watcher that falls behind the
+// events is stopped, so it can watch again and find the current state from the keys
+func (l *Lock) notify(eventType EventType, key string, r *Request) {
+	if atomic.LoadInt32(&l.watching) == 0 {
+		return
+	}
+
+	var event *Event
+	for _, watcher := range l.watchers.Load().([]*Watcher) {
+		if !watcher.matches(key) {
+			continue
+		}
+
+		if event == nil {
+			event = newEvent(eventType, key, r)
+		}
+
+		if !watcher.send(event) {
+			l.Unwatch(watcher)
+		}
+	}
+}
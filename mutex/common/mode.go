@@ -0,0 +1,49 @@
+package common
+
+type Mode byte
+
+var (
+	ModeExclusive       Mode = 0
+	ModeShared          Mode = 1
+	ModeIntentShared    Mode = 2 // Taken on the ancestors of a hierarchical key that is locked as shared
+	ModeIntentExclusive Mode = 3 // Taken on the ancestors of a hierarchical key that is locked as exclusive
+)
+
+// compatible checks if the holders with the modes can have the key together
+func (m Mode) compatible(other Mode) bool {
+	switch m {
+	case ModeIntentShared:
+		return other != ModeExclusive
+	case ModeIntentExclusive:
+		return other == ModeIntentShared || other == ModeIntentExclusive
+	case ModeShared:
+		return other == ModeIntentShared || other == ModeShared
+	default:
+		return false
+	}
+}
+
+// covers checks if the holder with the mode already has the access that the other mode asks for
+func (m Mode) covers(other Mode) bool {
+	switch m {
+	case ModeExclusive:
+		return true
+	case ModeShared, ModeIntentExclusive:
+		return other == m || other == ModeIntentShared
+	default:
+		return other == m
+	}
+}
+
+// isIntent checks if the mode is taken on the ancestors of a hierarchical key
+func (m Mode) isIntent() bool {
+	return m == ModeIntentShared || m == ModeIntentExclusive
+}
+
+// intent returns the mode that should be taken on the ancestors of a hierarchical key
+func (m Mode) intent() Mode {
+	if m == ModeShared || m == ModeIntentShared {
+		return ModeIntentShared
+	}
+	return ModeIntentExclusive
+}
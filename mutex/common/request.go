@@ -8,11 +8,32 @@ import (
 )
 
 type Request struct {
-	Id    string
-	Stamp time.Time
+	Id       string
+	Stamp    time.Time
+	Sequence uint64 // Ticket of the request in the queue of the key
 
 	SourceAddr string
 	RemoteAddr net.Addr
+	ClientId   string            // Identifies the client in the queue and the wait-for graph of the key
+	Reentrant  bool              // Lets the request reenter the key that is held by the same client identity
+	Session    string            // Binds the request to the session, so it is released when the session is closed
+	Metadata   map[string]string // Describes the holder like the owner name, the reason or the trace id
+
+	Mode     Mode
+	Priority uint8 // Higher priority requests take the key before the lower ones in the queue
+	Permits  uint16
+	Lease    time.Duration
+	Fence    uint64
+
+	holds      int
+	reentered  bool
+	intents    map[string]*Request // Intent requests on the ancestors of a hierarchical key
+	parent     string              // Owner token of the request that takes the intent on the ancestor
+	ready      chan error
+	queued     time.Time
+	expires    time.Time
+	leaseId    uint64
+	leaseTimer *time.Timer
 }
 
 func NewRequest(sourceAddr string, remoteAddr net.Addr) *Request {
@@ -23,3 +44,59 @@ func NewRequest(sourceAddr string, remoteAddr net.Addr) *Request {
 		RemoteAddr: remoteAddr,
 	}
 }
+
+// intent creates the request that is taken on the ancestors of the hierarchical key for this request
+func (r *Request) intent() *Request {
+	return &Request{
+		Id:         uuid.NewString(),
+		Stamp:      r.Stamp,
+		SourceAddr: r.SourceAddr,
+		RemoteAddr: r.RemoteAddr,
+		ClientId:   r.ClientId,
+		Reentrant:  r.Reentrant,
+		Session:    r.Session,
+		Metadata:   r.Metadata,
+		Mode:       r.Mode.intent(),
+		Priority:   r.Priority,
+		parent:     r.Id,
+	}
+}
+
+// clone creates a new request with the same details and owner token to be queued on another key
+func (r *Request) clone() *Request {
+	return &Request{
+		Id:         r.Id,
+		Stamp:      r.Stamp,
+		SourceAddr: r.SourceAddr,
+		RemoteAddr: r.RemoteAddr,
+		ClientId:   r.ClientId,
+		Reentrant:  r.Reentrant,
+		Session:    r.Session,
+		Metadata:   r.Metadata,
+		Mode:       r.Mode,
+		Priority:   r.Priority,
+		Permits:    r.Permits,
+		Lease:      r.Lease,
+	}
+}
+
+// snapshot copies the details of the request, so they can be read after the lock of the key is released while the
+// request itself is changed by the key
+func (r *Request) snapshot() *Request {
+	return &Request{
+		Id:         r.Id,
+		Stamp:      r.Stamp,
+		Sequence:   r.Sequence,
+		SourceAddr: r.SourceAddr,
+		RemoteAddr: r.RemoteAddr,
+		ClientId:   r.ClientId,
+		Reentrant:  r.Reentrant,
+		Session:    r.Session,
+		Metadata:   r.Metadata,
+		Mode:       r.Mode,
+		Priority:   r.Priority,
+		Permits:    r.Permits,
+		Lease:      r.Lease,
+		Fence:      r.Fence,
+	}
+}
@@ -0,0 +1,23 @@
+package common
+
+import "strings"
+
+type WaitForEdge struct {
+	Key    string
+	Waiter string
+	Holder string
+}
+
+type WaitForGraph []*WaitForEdge
+
+func (g WaitForGraph) Len() int { return len(g) }
+func (g WaitForGraph) Less(i, j int) bool {
+	if c := strings.Compare(g[i].Waiter, g[j].Waiter); c != 0 {
+		return c < 0
+	}
+	if c := strings.Compare(g[i].Holder, g[j].Holder); c != 0 {
+		return c < 0
+	}
+	return strings.Compare(g[i].Key, g[j].Key) < 0
+}
+func (g WaitForGraph) Swap(i, j int) { g[i], g[j] = g[j], g[i] }
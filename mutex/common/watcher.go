@@ -0,0 +1,71 @@
+package common
+
+import (
+	"strings"
+	"sync"
+)
+
+const watcherBuffer = 256
+
+// Watcher receives the events of a key or the keys that start with a prefix
+type Watcher struct {
+	key    string
+	prefix bool
+
+	mutex  sync.Mutex // Keeps the events channel from being closed while an event is sent
+	closed bool
+	events chan *Event
+}
+
+func newWatcher(key string, prefix bool) *Watcher {
+	return &Watcher{
+		key:    key,
+		prefix: prefix,
+		mutex:  sync.Mutex{},
+		events: make(chan *Event, watcherBuffer),
+	}
+}
+
+// Events returns the channel of the events. It is closed when the watcher is stopped or falls behind the events
+func (w *Watcher) Events() <-chan *Event {
+	return w.events
+}
+
+func (w *Watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return strings.Compare(w.key, key) == 0
+}
+
+// send puts the event to the events channel without blocking. If the channel is full, the watcher is closed and
+// false is returned
+func (w *Watcher) send(event *Event) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return true
+	}
+
+	select {
+	case w.events <- event:
+		return true
+	default:
+		w.closed = true
+		close(w.events)
+		return false
+	}
+}
+
+// close closes the events channel if it is not closed yet
+func (w *Watcher) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.events)
+}
@@ -47,6 +47,11 @@ func main() {
 	wg := &sync.WaitGroup{}
 	lock := common.NewLock()
 
+	if strings.Compare(strings.ToLower(os.Getenv("HIERARCHICAL_KEYS")), "true") == 0 {
+		fmt.Println("INFO: HIERARCHICAL_KEYS: true, keys are handled as paths separated by /")
+		lock = common.NewHierarchicalLock("/")
+	}
+
 	mutex, err := service.NewMutex(bindAddr, lock)
 	if err != nil {
 		fmt.Printf("ERROR: Service unable to be prepared: %s\n", err)
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/freakmaxi/locking-center/mutex/common"
 )
@@ -95,6 +97,14 @@ func (m *manager) process(command string, conn net.Conn) error {
 		return m.reset(conn, true)
 	case "RSBS":
 		return m.reset(conn, false)
+	case "GRPH":
+		return m.graph(conn)
+	case "STAT":
+		return m.stats(conn)
+	case "BARS":
+		return m.barriers(conn)
+	case "LTCH":
+		return m.latches(conn)
 	default:
 		return fmt.Errorf("not a meaningful command")
 	}
@@ -118,27 +128,181 @@ func (m *manager) keys(conn net.Conn) error {
 			return err
 		}
 
-		sourceAddrSize := uint8(len(report.Current.SourceAddr))
-		if err := m.socketIO.WriteBinaryWithTimeout(conn, sourceAddrSize); err != nil {
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Mode); err != nil {
 			return err
 		}
 
-		sourceAddrBytes := []byte(report.Current.SourceAddr)
-		if err := m.socketIO.WriteWithTimeout(conn, sourceAddrBytes); err != nil {
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Permits); err != nil {
 			return err
 		}
 
-		endPointSize := uint8(len(report.Current.RemoteAddr.String()))
-		if err := m.socketIO.WriteBinaryWithTimeout(conn, endPointSize); err != nil {
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Fence); err != nil {
 			return err
 		}
 
-		endPointBytes := []byte(report.Current.RemoteAddr.String())
-		if err := m.socketIO.WriteWithTimeout(conn, endPointBytes); err != nil {
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(len(report.Holders))); err != nil {
 			return err
 		}
 
-		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Current.Stamp.Unix()); err != nil {
+		for _, holder := range report.Holders {
+			if err := m.holder(conn, holder); err != nil {
+				return err
+			}
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(len(report.Queue))); err != nil {
+			return err
+		}
+
+		for _, waiter := range report.Queue {
+			if err := m.waiter(conn, waiter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *manager) holder(conn net.Conn, holder *common.HolderReport) error {
+	sourceAddrSize := uint8(len(holder.Request.SourceAddr))
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, sourceAddrSize); err != nil {
+		return err
+	}
+
+	sourceAddrBytes := []byte(holder.Request.SourceAddr)
+	if err := m.socketIO.WriteWithTimeout(conn, sourceAddrBytes); err != nil {
+		return err
+	}
+
+	endPointSize := uint8(len(holder.Request.RemoteAddr.String()))
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, endPointSize); err != nil {
+		return err
+	}
+
+	endPointBytes := []byte(holder.Request.RemoteAddr.String())
+	if err := m.socketIO.WriteWithTimeout(conn, endPointBytes); err != nil {
+		return err
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, holder.Request.Stamp.Unix()); err != nil {
+		return err
+	}
+
+	var leaseLeft int64 // milliseconds, 0 means the lock does not expire
+	if !holder.Expires.IsZero() {
+		leaseLeft = time.Until(holder.Expires).Milliseconds()
+		if leaseLeft < 1 {
+			leaseLeft = 1
+		}
+	}
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, leaseLeft); err != nil {
+		return err
+	}
+
+	metadataKeys := make([]string, 0, len(holder.Request.Metadata))
+	for key := range holder.Request.Metadata {
+		metadataKeys = append(metadataKeys, key)
+	}
+	sort.Strings(metadataKeys)
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint8(len(metadataKeys))); err != nil {
+		return err
+	}
+
+	for _, key := range metadataKeys {
+		keySize := uint8(len(key))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, keySize); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteWithTimeout(conn, []byte(key)); err != nil {
+			return err
+		}
+
+		value := holder.Request.Metadata[key]
+
+		valueSize := uint8(len(value))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, valueSize); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteWithTimeout(conn, []byte(value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *manager) waiter(conn net.Conn, waiter *common.WaiterReport) error {
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, waiter.Request.Priority); err != nil {
+		return err
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, waiter.Request.Sequence); err != nil {
+		return err
+	}
+
+	sourceAddrSize := uint8(len(waiter.Request.SourceAddr))
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, sourceAddrSize); err != nil {
+		return err
+	}
+
+	sourceAddrBytes := []byte(waiter.Request.SourceAddr)
+	if err := m.socketIO.WriteWithTimeout(conn, sourceAddrBytes); err != nil {
+		return err
+	}
+
+	endPointSize := uint8(len(waiter.Request.RemoteAddr.String()))
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, endPointSize); err != nil {
+		return err
+	}
+
+	endPointBytes := []byte(waiter.Request.RemoteAddr.String())
+	if err := m.socketIO.WriteWithTimeout(conn, endPointBytes); err != nil {
+		return err
+	}
+
+	waited := time.Since(waiter.Queued).Milliseconds()
+	return m.socketIO.WriteBinaryWithTimeout(conn, waited)
+}
+
+func (m *manager) graph(conn net.Conn) error {
+	graph := m.lock.WaitFor()
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(len(graph))); err != nil {
+		return err
+	}
+
+	for _, edge := range graph {
+		keySize := uint8(len(edge.Key))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, keySize); err != nil {
+			return err
+		}
+
+		keyBytes := []byte(edge.Key)
+		if err := m.socketIO.WriteWithTimeout(conn, keyBytes); err != nil {
+			return err
+		}
+
+		waiterSize := uint8(len(edge.Waiter))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, waiterSize); err != nil {
+			return err
+		}
+
+		waiterBytes := []byte(edge.Waiter)
+		if err := m.socketIO.WriteWithTimeout(conn, waiterBytes); err != nil {
+			return err
+		}
+
+		holderSize := uint8(len(edge.Holder))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, holderSize); err != nil {
+			return err
+		}
+
+		holderBytes := []byte(edge.Holder)
+		if err := m.socketIO.WriteWithTimeout(conn, holderBytes); err != nil {
 			return err
 		}
 	}
@@ -146,6 +310,74 @@ func (m *manager) keys(conn net.Conn) error {
 	return nil
 }
 
+func (m *manager) barriers(conn net.Conn) error {
+	reports := m.lock.Barriers()
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(len(reports))); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		keySize := uint8(len(report.Key))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, keySize); err != nil {
+			return err
+		}
+
+		keyBytes := []byte(report.Key)
+		if err := m.socketIO.WriteWithTimeout(conn, keyBytes); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Parties); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Arrived); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *manager) latches(conn net.Conn) error {
+	reports := m.lock.Latches()
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(len(reports))); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		keySize := uint8(len(report.Key))
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, keySize); err != nil {
+			return err
+		}
+
+		keyBytes := []byte(report.Key)
+		if err := m.socketIO.WriteWithTimeout(conn, keyBytes); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Count); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Remaining); err != nil {
+			return err
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, report.Waiting); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *manager) stats(conn net.Conn) error {
+	return m.socketIO.WriteBinaryWithTimeout(conn, uint32(m.lock.Channels()))
+}
+
 func (m *manager) reset(conn net.Conn, byKey bool) error {
 	var resetKeysCount uint32
 	if err := m.socketIO.ReadBinaryWithTimeout(conn, &resetKeysCount); err != nil {
@@ -1,10 +1,14 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/freakmaxi/locking-center/mutex/common"
 )
@@ -16,6 +20,40 @@ var (
 	maUnlock        mutexAction = 2
 	maResetByKey    mutexAction = 3
 	maResetBySource mutexAction = 4
+	maRenew         mutexAction = 5
+	maTryLock       mutexAction = 6
+	maAcquire       mutexAction = 7
+	maPosition      mutexAction = 8
+	maLockAll       mutexAction = 9
+	maSession       mutexAction = 10
+	maArrive        mutexAction = 11
+	maWait          mutexAction = 12
+	maSignal        mutexAction = 13
+	maBroadcast     mutexAction = 14
+	maWatch         mutexAction = 15
+	maCampaign      mutexAction = 16
+	maResign        mutexAction = 17
+	maLeader        mutexAction = 18
+	maObserve       mutexAction = 19
+	maCreateLatch   mutexAction = 20
+	maCountDown     mutexAction = 21
+	maAwaitLatch    mutexAction = 22
+	maLatchStatus   mutexAction = 23
+	maLockOptions   mutexAction = 24
+)
+
+const defaultKeepAlive = 30 * time.Second
+const maxMetadata = 16
+const maxMetadataKey = 64
+
+type mutexResult byte
+
+var (
+	mrSuccess  mutexResult = '+'
+	mrFailure  mutexResult = '-'
+	mrBusy     mutexResult = '*'
+	mrTimeout  mutexResult = '~'
+	mrDeadlock mutexResult = '#'
 )
 
 type Mutex interface {
@@ -76,15 +114,19 @@ func (m *mutex) handler(conn net.Conn) {
 		if err != io.EOF {
 			fmt.Printf("ERROR: Service process is failed: address: %s,%s\n", conn.RemoteAddr(), err)
 		}
-		if err := m.socketIO.WriteWithTimeout(conn, []byte{'-'}); err != nil {
+		if err := m.socketIO.WriteWithTimeout(conn, []byte{byte(mrFailure)}); err != nil {
 			fmt.Printf("ERROR: Service failed on unsuccess message: address: %s,%s\n", conn.RemoteAddr(), err)
 		}
 	}
 }
 
 func (m *mutex) success(conn net.Conn) bool {
-	if err := m.socketIO.WriteWithTimeout(conn, []byte{'+'}); err != nil {
-		fmt.Printf("ERROR: Service failed on success message: address: %s,%s\n", conn.RemoteAddr(), err)
+	return m.result(conn, mrSuccess)
+}
+
+func (m *mutex) result(conn net.Conn, result mutexResult) bool {
+	if err := m.socketIO.WriteWithTimeout(conn, []byte{byte(result)}); err != nil {
+		fmt.Printf("ERROR: Service failed on result message: address: %s,%s\n", conn.RemoteAddr(), err)
 		return false
 	}
 	return true
@@ -99,12 +141,52 @@ func (m *mutex) process(conn net.Conn) error {
 	switch action {
 	case maLock:
 		return m.cmdLock(conn)
+	case maLockOptions:
+		return m.cmdLockOptions(conn)
 	case maUnlock:
 		return m.cmdUnlock(conn)
 	case maResetByKey:
 		return m.cmdResetByKey(conn)
 	case maResetBySource:
 		return m.cmdResetBySource(conn)
+	case maRenew:
+		return m.cmdRenew(conn)
+	case maTryLock:
+		return m.cmdTryLock(conn)
+	case maAcquire:
+		return m.cmdAcquire(conn)
+	case maPosition:
+		return m.cmdPosition(conn)
+	case maLockAll:
+		return m.cmdLockAll(conn)
+	case maSession:
+		return m.cmdSession(conn)
+	case maArrive:
+		return m.cmdArrive(conn)
+	case maWait:
+		return m.cmdWait(conn)
+	case maSignal:
+		return m.cmdSignal(conn, false)
+	case maBroadcast:
+		return m.cmdSignal(conn, true)
+	case maWatch:
+		return m.cmdWatch(conn)
+	case maCampaign:
+		return m.cmdCampaign(conn)
+	case maResign:
+		return m.cmdUnlock(conn)
+	case maLeader:
+		return m.cmdLeader(conn)
+	case maObserve:
+		return m.cmdObserve(conn)
+	case maCreateLatch:
+		return m.cmdCreateLatch(conn)
+	case maCountDown:
+		return m.cmdCountDown(conn)
+	case maAwaitLatch:
+		return m.cmdAwaitLatch(conn)
+	case maLatchStatus:
+		return m.cmdLatchStatus(conn)
 	default:
 		return fmt.Errorf("undefined action")
 	}
@@ -116,6 +198,10 @@ func (m *mutex) readString(conn net.Conn) (*string, error) {
 		return nil, err
 	}
 
+	if valueSize < 0 {
+		return nil, fmt.Errorf("string should not be longer than 127 bytes")
+	}
+
 	valueBytes := make([]byte, valueSize)
 	if err := m.socketIO.ReadWithTimeout(conn, valueBytes, len(valueBytes)); err != nil {
 		return nil, err
@@ -126,6 +212,138 @@ func (m *mutex) readString(conn net.Conn) (*string, error) {
 	return &value, nil
 }
 
+func (m *mutex) readMode(conn net.Conn) (common.Mode, error) {
+	var mode common.Mode
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &mode); err != nil {
+		return mode, err
+	}
+
+	switch mode {
+	case common.ModeExclusive, common.ModeShared:
+		return mode, nil
+	default:
+		return mode, fmt.Errorf("undefined lock mode")
+	}
+}
+
+// readFlag reads 1 byte option that is enabled with 1 and disabled with 0
+func (m *mutex) readFlag(conn net.Conn) (bool, error) {
+	var flag uint8
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &flag); err != nil {
+		return false, err
+	}
+
+	switch flag {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("undefined flag value")
+	}
+}
+
+// readMetadata reads the key/value pairs that describe the holder of the lock
+func (m *mutex) readMetadata(conn net.Conn) (map[string]string, error) {
+	var count uint8
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &count); err != nil {
+		return nil, err
+	}
+
+	if count > maxMetadata {
+		return nil, fmt.Errorf("metadata should not have more than %d entries", maxMetadata)
+	}
+
+	metadata := make(map[string]string, count)
+	for ; count > 0; count-- {
+		key, err := m.readMetadataString(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(key) == 0 || len(key) > maxMetadataKey {
+			return nil, fmt.Errorf("metadata key should have 1 to %d bytes", maxMetadataKey)
+		}
+
+		value, err := m.readMetadataString(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		metadata[key] = value
+	}
+
+	return metadata, nil
+}
+
+// readMetadataString reads the metadata string that has its length as unsigned, so the values can be up to 255 bytes
+func (m *mutex) readMetadataString(conn net.Conn) (string, error) {
+	var valueSize uint8
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &valueSize); err != nil {
+		return "", err
+	}
+
+	valueBytes := make([]byte, valueSize)
+	if err := m.socketIO.ReadWithTimeout(conn, valueBytes, len(valueBytes)); err != nil {
+		return "", err
+	}
+
+	return string(valueBytes), nil
+}
+
+func (m *mutex) writeString(conn net.Conn, value string) error {
+	valueSize := int8(len(value))
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, valueSize); err != nil {
+		return err
+	}
+	return m.socketIO.WriteWithTimeout(conn, []byte(value))
+}
+
+// granted answers the lock request with success, the owner token and the fencing token of the request
+func (m *mutex) granted(conn net.Conn, request *common.Request) bool {
+	if !m.success(conn) {
+		return false
+	}
+
+	if err := m.writeString(conn, request.Id); err != nil {
+		fmt.Printf("ERROR: Service failed on owner token message: address: %s,%s\n", conn.RemoteAddr(), err)
+		return false
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, request.Fence); err != nil {
+		fmt.Printf("ERROR: Service failed on fencing token message: address: %s,%s\n", conn.RemoteAddr(), err)
+		return false
+	}
+
+	return true
+}
+
+// grantedAll answers the multi-key lock request with success and the owner and fencing tokens of the keys in the
+// order of the request
+func (m *mutex) grantedAll(conn net.Conn, keys []string, requests map[string]*common.Request) bool {
+	if !m.success(conn) {
+		return false
+	}
+
+	for _, key := range keys {
+		request := requests[key]
+
+		if err := m.writeString(conn, request.Id); err != nil {
+			fmt.Printf("ERROR: Service failed on owner token message: address: %s,%s\n", conn.RemoteAddr(), err)
+			return false
+		}
+
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, request.Fence); err != nil {
+			fmt.Printf("ERROR: Service failed on fencing token message: address: %s,%s\n", conn.RemoteAddr(), err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// cmdLock locks the key with the original package that has only the key and the source address. The lock is
+// exclusive, it does not expire and waits until the key is granted
 func (m *mutex) cmdLock(conn net.Conn) error {
 	key, err := m.readString(conn)
 	if err != nil {
@@ -144,12 +362,294 @@ func (m *mutex) cmdLock(conn net.Conn) error {
 
 	m.socketIO.Idle(conn)
 
-	for !m.lock.Lock(*key, sourceAddr, conn.RemoteAddr()) {
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+
+	return m.acquire(conn, *key, request, 0)
+}
+
+// cmdLockOptions locks the key with the package that carries the lock options after the source address
+func (m *mutex) cmdLockOptions(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	request, wait, err := m.readLockRequest(conn, true)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	return m.acquire(conn, *key, request, wait)
+}
+
+func (m *mutex) cmdLockAll(conn net.Conn) error {
+	var keysCount uint8
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &keysCount); err != nil {
+		return err
+	}
+
+	if keysCount == 0 {
+		return fmt.Errorf("keys should be defined")
+	}
+
+	keys := make([]string, 0, keysCount)
+	for ; keysCount > 0; keysCount-- {
+		key, err := m.readString(conn)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, *key)
+	}
+
+	request, wait, err := m.readLockRequest(conn, true)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := m.waitContext(wait)
+	defer cancel()
+
+	stop := m.watch(conn, cancel)
+	requests, err := m.lock.LockAll(ctx, keys, request)
+	stop()
+
+	if done, err := m.answerWait(conn, err); done {
+		return err
+	}
+
+	// If connection is closed before the answer, cancel the locks
+	if !m.grantedAll(conn, keys, requests) {
+		for key, keyRequest := range requests {
+			_ = m.lock.Unlock(key, keyRequest.Id)
+		}
+	}
+
+	return nil
+}
+
+// readLockRequest reads the lock request details that follow the key and the wait time of the request. Requests that
+// are not queued, like try locking, do not have the wait time and the priority in the package
+func (m *mutex) readLockRequest(conn net.Conn, queued bool) (*common.Request, uint32, error) {
+	sourceAddrPtr, err := m.readString(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+	sourceAddr := *sourceAddrPtr
+
+	if len(sourceAddr) == 0 {
+		sourceAddr = common.ExtractSourceAddr(conn)
+	}
+
+	var lease uint32 // milliseconds, 0 keeps the lock until it is unlocked
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &lease); err != nil {
+		return nil, 0, err
+	}
+
+	var wait uint32 // milliseconds, 0 waits until the key is granted
+	if queued {
+		if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	mode, err := m.readMode(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clientId, err := m.readString(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reentrant, err := m.readFlag(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var priority uint8
+	if queued {
+		if err := m.socketIO.ReadBinaryWithTimeout(conn, &priority); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	session, err := m.readString(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	metadata, err := m.readMetadata(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+	request.ClientId = *clientId
+	request.Reentrant = reentrant
+	request.Session = *session
+	request.Metadata = metadata
+	request.Mode = mode
+	request.Priority = priority
+	request.Lease = time.Duration(lease) * time.Millisecond
+
+	return request, wait, nil
+}
+
+func (m *mutex) cmdAcquire(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	sourceAddrPtr, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+	sourceAddr := *sourceAddrPtr
+
+	if len(sourceAddr) == 0 {
+		sourceAddr = common.ExtractSourceAddr(conn)
+	}
+
+	var permits uint16
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &permits); err != nil {
+		return err
+	}
+
+	if permits == 0 {
+		return fmt.Errorf("permit count should be defined")
+	}
+
+	var lease uint32 // milliseconds, 0 keeps the permit until it is released
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &lease); err != nil {
+		return err
+	}
+
+	var wait uint32 // milliseconds, 0 waits until a permit is granted
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+	request.Permits = permits
+	request.Lease = time.Duration(lease) * time.Millisecond
+
+	return m.acquire(conn, *key, request, wait)
+}
+
+// answerWait answers the request that stops waiting without success. It returns true when the command is done with
+// the returned error, so the command goes on only when the wait is successful
+func (m *mutex) answerWait(conn net.Conn, err error) (bool, error) {
+	switch err {
+	case nil:
+		return false, nil
+	case context.Canceled: // Client is gone while waiting, there is no one to answer
+		return true, nil
+	case context.DeadlineExceeded:
+		m.result(conn, mrTimeout)
+		return true, nil
+	case common.ErrDeadlock:
+		m.result(conn, mrDeadlock)
+		return true, nil
+	default:
+		return true, err
+	}
+}
+
+// waitContext creates the context that limits the waiting time of the request, 0 waits without a limit
+func (m *mutex) waitContext(wait uint32) (context.Context, context.CancelFunc) {
+	if wait == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(wait)*time.Millisecond)
+}
+
+// watch cancels the waiting request as soon as the client closes the connection, so the request leaves the queue
+// without waiting for its turn. The returned function stops watching before the answer is written
+func (m *mutex) watch(conn net.Conn, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		buffer := make([]byte, 1)
+		for {
+			if _, err := conn.Read(buffer); err != nil {
+				select {
+				case <-done:
+				default:
+					cancel()
+				}
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		_ = conn.SetReadDeadline(time.Now()) // Unblocks the pending read
+		<-stopped
+		m.socketIO.Idle(conn)
+	}
+}
+
+// acquire waits until the key is granted to the request and answers the client
+func (m *mutex) acquire(conn net.Conn, key string, request *common.Request, wait uint32) error {
+	ctx, cancel := m.waitContext(wait)
+	defer cancel()
+
+	stop := m.watch(conn, cancel)
+	err := m.lock.Lock(ctx, key, request)
+	for err == common.ErrReset {
+		err = m.lock.Lock(ctx, key, request)
+	}
+	stop()
+
+	if done, err := m.answerWait(conn, err); done {
+		return err
+	}
+
+	// If connection is closed before the answer, cancel the lock
+	if !m.granted(conn, request) {
+		_ = m.lock.Unlock(key, request.Id)
+	}
+
+	return nil
+}
+
+func (m *mutex) cmdTryLock(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	request, _, err := m.readLockRequest(conn, false)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	err = m.lock.TryLock(*key, request)
+	if err == common.ErrBusy {
+		m.result(conn, mrBusy)
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
 	// If connection is closed before the answer, cancel the lock
-	if !m.success(conn) {
-		m.lock.Unlock(*key)
+	if !m.granted(conn, request) {
+		_ = m.lock.Unlock(*key, request.Id)
 	}
 
 	return nil
@@ -161,9 +661,16 @@ func (m *mutex) cmdUnlock(conn net.Conn) error {
 		return err
 	}
 
+	token, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
 	m.socketIO.Idle(conn)
 
-	m.lock.Unlock(*key)
+	if err := m.lock.Unlock(*key, *token); err != nil {
+		return err
+	}
 	m.success(conn)
 
 	return nil
@@ -200,3 +707,558 @@ func (m *mutex) cmdResetBySource(conn net.Conn) error {
 
 	return nil
 }
+
+func (m *mutex) cmdRenew(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	token, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	var lease uint32 // milliseconds, 0 renews with the lease duration of the lock request
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &lease); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	if err := m.lock.Renew(*key, *token, time.Duration(lease)*time.Millisecond); err != nil {
+		return err
+	}
+	m.success(conn)
+
+	return nil
+}
+
+// cmdWait releases the key of the holder until a signal arrives on the key and answers with the owner and fencing
+// tokens when the key is taken back
+func (m *mutex) cmdWait(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	token, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	var wait uint32 // milliseconds, 0 waits until the key is taken back
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := m.waitContext(wait)
+	defer cancel()
+
+	stop := m.watch(conn, cancel)
+	request, err := m.lock.Wait(ctx, *key, *token)
+	stop()
+
+	if done, err := m.answerWait(conn, err); done {
+		return err
+	}
+
+	// If connection is closed before the answer, cancel the lock
+	if !m.granted(conn, request) {
+		_ = m.lock.Unlock(*key, request.Id)
+	}
+
+	return nil
+}
+
+// cmdSignal wakes up the waiters of the key and answers with the number of the woken waiters
+func (m *mutex) cmdSignal(conn net.Conn, broadcast bool) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	count := m.lock.Signal(*key, broadcast)
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(count)); err != nil {
+		fmt.Printf("ERROR: Service failed on signal message: address: %s,%s\n", conn.RemoteAddr(), err)
+	}
+
+	return nil
+}
+
+func (m *mutex) cmdPosition(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	clientId, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	var priority uint8 // Priority of a prospective request to find the number of the requests ahead of it
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &priority); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	position, waiting, ahead := m.lock.Position(*key, *clientId, priority)
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, int32(position)); err != nil {
+		fmt.Printf("ERROR: Service failed on position message: address: %s,%s\n", conn.RemoteAddr(), err)
+		return nil
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(waiting)); err != nil {
+		fmt.Printf("ERROR: Service failed on position message: address: %s,%s\n", conn.RemoteAddr(), err)
+		return nil
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, uint32(ahead)); err != nil {
+		fmt.Printf("ERROR: Service failed on position message: address: %s,%s\n", conn.RemoteAddr(), err)
+	}
+
+	return nil
+}
+
+// cmdSession opens a session and keeps it alive as long as the client sends keepalive bytes in time. When the
+// connection drops, the keys that are bound to the session are released
+func (m *mutex) cmdSession(conn net.Conn) error {
+	var keepAlive uint32 // milliseconds, 0 uses the default keepalive timeout
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &keepAlive); err != nil {
+		return err
+	}
+
+	timeout := defaultKeepAlive
+	if keepAlive > 0 {
+		timeout = time.Duration(keepAlive) * time.Millisecond
+	}
+
+	sessionId := m.lock.OpenSession()
+	defer m.lock.CloseSession(sessionId)
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	if err := m.writeString(conn, sessionId); err != nil {
+		fmt.Printf("ERROR: Service failed on session message: address: %s,%s\n", conn.RemoteAddr(), err)
+		return nil
+	}
+
+	buffer := make([]byte, 1)
+	for {
+		if err := m.socketIO.ReadWithDeadline(conn, buffer, len(buffer), timeout); err != nil {
+			return nil
+		}
+
+		if !m.success(conn) {
+			return nil
+		}
+	}
+}
+
+func (m *mutex) cmdArrive(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	sourceAddrPtr, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+	sourceAddr := *sourceAddrPtr
+
+	if len(sourceAddr) == 0 {
+		sourceAddr = common.ExtractSourceAddr(conn)
+	}
+
+	var parties uint16
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &parties); err != nil {
+		return err
+	}
+
+	if parties == 0 {
+		return fmt.Errorf("party count should be defined")
+	}
+
+	var wait uint32 // milliseconds, 0 waits until all parties arrive
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := m.waitContext(wait)
+	defer cancel()
+
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+
+	stop := m.watch(conn, cancel)
+	err = m.lock.Arrive(ctx, *key, request, parties)
+	stop()
+
+	if done, err := m.answerWait(conn, err); done {
+		return err
+	}
+
+	m.success(conn)
+
+	return nil
+}
+
+// cmdWatch streams the events of the key, or the keys that start with it as a prefix, until the client closes the
+// connection or falls behind the events
+func (m *mutex) cmdWatch(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := m.readFlag(conn)
+	if err != nil {
+		return err
+	}
+
+	if !prefix && len(*key) == 0 {
+		return fmt.Errorf("key should be defined")
+	}
+
+	m.socketIO.Idle(conn)
+
+	watcher := m.lock.Watch(*key, prefix)
+	defer m.lock.Unwatch(watcher)
+
+	if !m.success(conn) {
+		return nil
+	}
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := m.watch(conn, cancel)
+	defer stop()
+
+	for {
+		select {
+		case event, more := <-watcher.Events():
+			if !more {
+				return nil
+			}
+
+			if err := m.socketIO.StreamWithTimeout(conn, m.event(event)); err != nil {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// event creates the message of the event in type, key, stamp, source address, client identity and fencing token order
+func (m *mutex) event(event *common.Event) []byte {
+	buffer := &bytes.Buffer{}
+
+	_ = binary.Write(buffer, binary.LittleEndian, event.Type)
+
+	_ = binary.Write(buffer, binary.LittleEndian, int8(len(event.Key)))
+	buffer.WriteString(event.Key)
+
+	_ = binary.Write(buffer, binary.LittleEndian, event.Stamp.Unix())
+
+	_ = binary.Write(buffer, binary.LittleEndian, int8(len(event.SourceAddr)))
+	buffer.WriteString(event.SourceAddr)
+
+	_ = binary.Write(buffer, binary.LittleEndian, int8(len(event.ClientId)))
+	buffer.WriteString(event.ClientId)
+
+	_ = binary.Write(buffer, binary.LittleEndian, event.Fence)
+
+	return buffer.Bytes()
+}
+
+// cmdCampaign waits until the candidate becomes the leader of the election key. Leadership is an exclusive lock
+// that is held by the identity of the candidate under a lease
+func (m *mutex) cmdCampaign(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	sourceAddrPtr, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+	sourceAddr := *sourceAddrPtr
+
+	if len(sourceAddr) == 0 {
+		sourceAddr = common.ExtractSourceAddr(conn)
+	}
+
+	identity, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	if len(*identity) == 0 {
+		return fmt.Errorf("candidate identity should be defined")
+	}
+
+	var lease uint32 // milliseconds
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &lease); err != nil {
+		return err
+	}
+
+	if lease == 0 {
+		return fmt.Errorf("leadership lease should be defined")
+	}
+
+	var wait uint32 // milliseconds, 0 waits until the candidate becomes the leader
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+	request.ClientId = *identity
+	request.Mode = common.ModeExclusive
+	request.Lease = time.Duration(lease) * time.Millisecond
+
+	return m.acquire(conn, *key, request, wait)
+}
+
+func (m *mutex) cmdLeader(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	if err := m.socketIO.WriteWithTimeout(conn, m.leader(m.lock.Leader(*key))); err != nil {
+		fmt.Printf("ERROR: Service failed on leader message: address: %s,%s\n", conn.RemoteAddr(), err)
+	}
+
+	return nil
+}
+
+// cmdObserve streams the leader of the election key each time it changes, starting with the current one
+func (m *mutex) cmdObserve(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	watcher := m.lock.Watch(*key, false)
+	defer m.lock.Unwatch(watcher)
+
+	if !m.success(conn) {
+		return nil
+	}
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := m.watch(conn, cancel)
+	defer stop()
+
+	var fence uint64
+	leader := m.lock.Leader(*key)
+	if leader != nil {
+		fence = leader.Fence
+	}
+
+	if err := m.socketIO.StreamWithTimeout(conn, m.leader(leader)); err != nil {
+		return nil
+	}
+
+	for {
+		select {
+		case _, more := <-watcher.Events():
+			if !more {
+				return nil
+			}
+
+			var current uint64
+			leader := m.lock.Leader(*key)
+			if leader != nil {
+				current = leader.Fence
+			}
+
+			if current == fence { // Leadership has not changed
+				continue
+			}
+			fence = current
+
+			if err := m.socketIO.StreamWithTimeout(conn, m.leader(leader)); err != nil {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// leader creates the message of the leader in identity and fencing token order. Empty identity and 0 fencing
+// token mean that there is no leader
+func (m *mutex) leader(leader *common.Request) []byte {
+	var identity string
+	var fence uint64
+	if leader != nil {
+		identity = leader.ClientId
+		fence = leader.Fence
+	}
+
+	buffer := &bytes.Buffer{}
+
+	_ = binary.Write(buffer, binary.LittleEndian, int8(len(identity)))
+	buffer.WriteString(identity)
+
+	_ = binary.Write(buffer, binary.LittleEndian, fence)
+
+	return buffer.Bytes()
+}
+
+func (m *mutex) cmdCreateLatch(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	var count uint32
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &count); err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("latch count should be defined")
+	}
+
+	m.socketIO.Idle(conn)
+
+	if err := m.lock.CreateLatch(*key, count); err != nil {
+		return err
+	}
+	m.success(conn)
+
+	return nil
+}
+
+// cmdCountDown decreases the count of the latch and answers with the remaining count
+func (m *mutex) cmdCountDown(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	remaining, err := m.lock.CountDown(*key)
+	if err != nil {
+		return err
+	}
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	if err := m.socketIO.WriteBinaryWithTimeout(conn, remaining); err != nil {
+		fmt.Printf("ERROR: Service failed on count down message: address: %s,%s\n", conn.RemoteAddr(), err)
+	}
+
+	return nil
+}
+
+func (m *mutex) cmdAwaitLatch(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	sourceAddrPtr, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+	sourceAddr := *sourceAddrPtr
+
+	if len(sourceAddr) == 0 {
+		sourceAddr = common.ExtractSourceAddr(conn)
+	}
+
+	var wait uint32 // milliseconds, 0 waits until the latch is open
+	if err := m.socketIO.ReadBinaryWithTimeout(conn, &wait); err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	ctx, cancel := m.waitContext(wait)
+	defer cancel()
+
+	request := common.NewRequest(sourceAddr, conn.RemoteAddr())
+
+	stop := m.watch(conn, cancel)
+	err = m.lock.WaitLatch(ctx, *key, request)
+	stop()
+
+	if done, err := m.answerWait(conn, err); done {
+		return err
+	}
+
+	m.success(conn)
+
+	return nil
+}
+
+// cmdLatchStatus answers with the count, the remaining count and the number of the waiting requests of the latch
+func (m *mutex) cmdLatchStatus(conn net.Conn) error {
+	key, err := m.readString(conn)
+	if err != nil {
+		return err
+	}
+
+	m.socketIO.Idle(conn)
+
+	report, err := m.lock.LatchStatus(*key)
+	if err != nil {
+		return err
+	}
+
+	if !m.success(conn) {
+		return nil
+	}
+
+	for _, value := range []uint32{report.Count, report.Remaining, report.Waiting} {
+		if err := m.socketIO.WriteBinaryWithTimeout(conn, value); err != nil {
+			fmt.Printf("ERROR: Service failed on latch status message: address: %s,%s\n", conn.RemoteAddr(), err)
+			return nil
+		}
+	}
+
+	return nil
+}
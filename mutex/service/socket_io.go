@@ -32,6 +32,15 @@ func (s *SocketIO) ReadWithTimeout(conn net.Conn, buffer []byte, size int) error
 	return err
 }
 
+// ReadWithDeadline reads the buffer, failing when the data does not arrive in the given duration
+func (s *SocketIO) ReadWithDeadline(conn net.Conn, buffer []byte, size int, duration time.Duration) error {
+	if err := conn.SetDeadline(time.Now().Add(duration)); err != nil {
+		return err
+	}
+	_, err := io.ReadAtLeast(conn, buffer, size)
+	return err
+}
+
 func (s *SocketIO) ReadBinaryWithTimeout(conn net.Conn, data interface{}) error {
 	if err := s.setDeadline(conn, 0); err != nil {
 		return err
@@ -47,6 +56,17 @@ func (s *SocketIO) WriteWithTimeout(conn net.Conn, b []byte) error {
 	return err
 }
 
+// StreamWithTimeout writes the buffer setting only the write deadline, so a pending read on the connection is not
+// affected
+func (s *SocketIO) StreamWithTimeout(conn net.Conn, b []byte) error {
+	seconds := len(b)/defaultTransferSpeed + 30
+	if err := conn.SetWriteDeadline(time.Now().Add(time.Second * time.Duration(seconds))); err != nil {
+		return err
+	}
+	_, err := conn.Write(b)
+	return err
+}
+
 func (s *SocketIO) WriteBinaryWithTimeout(conn net.Conn, data interface{}) error {
 	if err := s.setDeadline(conn, 0); err != nil {
 		return err